@@ -1,28 +1,30 @@
 package main
 
 import (
+	"bufio"
+	"errors"
 	"flag"
 	"fmt"
 	"image"
 	"image/color"
-	"image/draw"
-	_ "image/gif"
-	_ "image/jpeg"
-	_ "image/png"
+	"io"
+	"io/fs"
 	"log"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"regexp"
+	"runtime"
 	"runtime/pprof"
+	"sort"
+	"strings"
+	"syscall"
 	"time"
 
+	"github.com/sbinet/iview/viewer"
+	"github.com/sqweek/dialog"
 	"golang.org/x/exp/shiny/driver"
 	"golang.org/x/exp/shiny/screen"
-	_ "golang.org/x/image/bmp"
-	_ "golang.org/x/image/tiff"
-	"golang.org/x/mobile/event/key"
-	"golang.org/x/mobile/event/mouse"
-	"golang.org/x/mobile/event/paint"
-	"golang.org/x/mobile/event/size"
 )
 
 var (
@@ -30,18 +32,157 @@ var (
 	// Errors will always be written to stderr.
 	flagVerbose bool
 
-	// The initial width and height of the window.
+	// The initial width and height of the window, and whether either was
+	// given explicitly, rather than restored from the previous run.
 	flagWidth, flagHeight int
+	sizeGiven             bool
+
+	// If set, the size and position of the window aren't remembered
+	// between runs.
+	flagNoRemember bool
+
+	// The minimum width and height of the window.
+	flagMinWidth, flagMinHeight int
 
 	// If set, the image window will automatically resize to the first image
 	// that it displays.
 	flagAutoResize bool
 
+	// If set, the window is centered on the display.
+	flagCenter bool
+
+	// The zoom factor of the images when they are first displayed.
+	flagZoom float64
+
 	// The amount to increment panning when using h,j,k,l
 	flagStepIncrement int
 
+	// The maximum factor by which the increment grows while the key is held.
+	flagPanAccel float64
+
+	// The quality of the JPEG images written when saving.
+	flagQuality int
+
 	// Whether to run a CPU profile.
 	flagProfile string
+
+	// If set, a heap profile is written to this file on exit.
+	flagMemProfile string
+
+	// The maximum number of decoded images kept in memory.
+	flagCacheSize int
+
+	// The maximum number of images decoded concurrently, or 0 for the
+	// number of CPUs.
+	flagJobs int
+
+	// Whether directories are searched for images recursively.
+	flagRecursive bool
+
+	// If set, only the files of a directory whose name matches this regular
+	// expression are displayed.
+	flagMatch string
+	matchRe   *regexp.Regexp
+
+	// The color of the window background, around the image.
+	flagBackground string
+	bkgCol         color.Color
+
+	// If set, the background color is sampled from the corners of each
+	// image, overriding -bg.
+	flagBgFromImage bool
+
+	// Whether a checkerboard is drawn behind the images, instead of the
+	// background color, to reveal transparent regions.
+	flagChecker bool
+
+	// Whether the color filter is kept when going to another image.
+	flagKeepFilter bool
+
+	// Whether 16-bit images are truncated instead of dithered.
+	flagNoDither bool
+
+	// Whether the window keeps the aspect ratio of the image when resized.
+	flagLockAspect bool
+
+	// Whether the files which can't be decoded are dropped.
+	flagSkipErrors bool
+
+	// Whether the navigation stops at the first and last images.
+	flagNoWrap bool
+
+	// Whether only the first image is shown.
+	flagOnce bool
+
+	// Whether the view is reset when going to another image.
+	flagResetView bool
+
+	// Whether the image can be panned out of the window.
+	flagUnboundedPan bool
+
+	// Whether the image stops as soon as it is released after dragging it.
+	flagNoMomentum bool
+
+	// Whether high density displays are handled as standard ones.
+	flagNoHiDPI bool
+
+	// The palette of the overlays.
+	flagTheme string
+
+	// The interpolation used to scale the images.
+	flagInterp string
+
+	// The ratio of the width to the height of the pixels, as a number or
+	// W:H, overriding the one recorded in the image files.
+	flagPixelAspect string
+	pixelAspect     float64
+
+	// The directory the images are moved to with 'v'.
+	flagMoveTo string
+
+	// The file the marked images are written to on exit, or "" for stdout.
+	flagMarksOut string
+
+	// The directory the thumbnails of the images are exported to, instead
+	// of displaying them, and their maximum width and height.
+	flagExportThumbs string
+	flagThumbSize    int
+
+	// Whether the pan and zoom of the windows are synchronized.
+	flagSync bool
+
+	// The size, as WxH, of the raw image read from stdin, if any, and the
+	// format of its pixels.
+	flagRaw    string
+	rawSize    image.Point
+	flagPixFmt string
+
+	// How long fetching an image from its URL may take.
+	flagTimeout time.Duration
+
+	// Whether the images fetched from URLs are fetched again, rather than
+	// read from the cache, and how long they are kept in the cache.
+	flagNoCache bool
+	flagURLTTL  time.Duration
+
+	// Whether the same file may be displayed several times.
+	flagAllowDups bool
+
+	// The file listing the images to display, if any.
+	flagPlaylist string
+
+	// If set, a file dialog is opened to pick an image when none is given.
+	flagPick bool
+
+	// If set, the list of files to display is printed, instead of being
+	// displayed.
+	flagList bool
+
+	// The order in which images are displayed: by name, mtime or size.
+	flagSort string
+
+	// Whether the sort order is reversed.
+	flagReverse bool
 )
 
 func init() {
@@ -55,29 +196,244 @@ func init() {
 		"The initial width of the window.")
 	flag.IntVar(&flagHeight, "height", 600,
 		"The initial height of the window.")
+	flag.BoolVar(&flagNoRemember, "no-remember", false,
+		"If set, the size and position of the window aren't saved on "+
+			"exit, nor restored from the previous run when -width and "+
+			"-height aren't given.")
+	flag.IntVar(&flagMinWidth, "min-width", 0,
+		"The minimum width of the window.")
+	flag.IntVar(&flagMinHeight, "min-height", 0,
+		"The minimum height of the window.")
 	flag.BoolVar(&flagAutoResize, "auto-resize", false,
 		"If set, window will resize to size of first image.")
+	flag.BoolVar(&flagCenter, "center", false,
+		"If set, the window is centered on the display.")
+	flag.Float64Var(&flagZoom, "zoom", 1,
+		"The zoom factor of the images when they are first displayed.")
 	flag.IntVar(&flagStepIncrement, "increment", 20,
 		"The increment (in pixels) used to pan the image.")
+	flag.IntVar(&flagQuality, "quality", 90,
+		"The quality, from 1 to 100, of the JPEG images written when "+
+			"saving (see the 's' key). Other formats are unaffected.")
+	flag.Float64Var(&flagPanAccel, "pan-accel", 8,
+		"The factor by which the panning increment grows, at most, while "+
+			"the key is held down (1 to keep it constant).")
 	flag.StringVar(&flagProfile, "profile", "",
 		"If set, a CPU profile will be saved to the file name provided.")
+	flag.StringVar(&flagMemProfile, "memprofile", "",
+		"If set, a heap profile will be saved to the file name provided "+
+			"on exit.")
+	flag.IntVar(&flagCacheSize, "cache", 16,
+		"The maximum number of decoded images kept in memory.")
+	flag.IntVar(&flagJobs, "jobs", 0,
+		"The maximum number of images decoded concurrently in the "+
+			"background (0 means the number of CPUs).")
+	flag.BoolVar(&flagRecursive, "recursive", false,
+		"If set, directories are searched for images recursively.")
+	flag.StringVar(&flagMatch, "match", "",
+		"If set, only the files in directories whose name matches this "+
+			"regular expression are shown.")
+	flag.StringVar(&flagBackground, "bg", "",
+		"The background color, either as #RRGGBB or one of black, white "+
+			"or gray. It defaults to the background of the -theme.")
+	flag.BoolVar(&flagBgFromImage, "bg-from-image", false,
+		"If set, the background color is the average color of the corners "+
+			"of each image, overriding -bg.")
+	flag.BoolVar(&flagChecker, "checker", false,
+		"If set, a checkerboard is drawn behind transparent images.")
+	flag.BoolVar(&flagKeepFilter, "keep-filter", false,
+		"If set, the color filter isn't reset when going to another image.")
+	flag.BoolVar(&flagNoDither, "no-dither", false,
+		"If set, images with 16 bits per channel aren't dithered when "+
+			"displayed.")
+	flag.BoolVar(&flagLockAspect, "lock-aspect", false,
+		"If set, the window keeps the aspect ratio of the image when it "+
+			"is resized.")
+	flag.BoolVar(&flagSkipErrors, "skip-errors", false,
+		"If set, the files which can't be decoded are dropped, instead of "+
+			"being shown as placeholders.")
+	flag.BoolVar(&flagNoWrap, "no-wrap", false,
+		"If set, the navigation stops at the first and last images "+
+			"instead of wrapping around.")
+	flag.BoolVar(&flagOnce, "once", false,
+		"If set, only the first image is shown, and the keys going to "+
+			"other images are disabled.")
+	flag.BoolVar(&flagResetView, "reset-view", false,
+		"If set, the pan and zoom of an image aren't restored when going "+
+			"back to it.")
+	flag.BoolVar(&flagUnboundedPan, "unbounded-pan", false,
+		"If set, the image can be panned entirely out of the window.")
+	flag.BoolVar(&flagNoMomentum, "no-momentum", false,
+		"If set, the image doesn't keep sliding after being dragged.")
+	flag.StringVar(&flagSort, "sort", "name",
+		"The order of the images: one of name, mtime or size.")
+	flag.BoolVar(&flagReverse, "reverse", false,
+		"If set, the sort order is reversed.")
+	flag.BoolVar(&flagNoHiDPI, "no-hidpi", false,
+		"If set, the window and the overlay text aren't enlarged on high "+
+			"density displays.")
+	flag.StringVar(&flagTheme, "theme", "dark",
+		"The colors of the overlays and of the default background: dark "+
+			"or light.")
+	flag.StringVar(&flagInterp, "interp", "",
+		"The interpolation used to scale the images: one of nearest, "+
+			"bilinear or catmullrom. By default, images are shrunk with "+
+			"catmullrom and enlarged with a fast approximation of bilinear. "+
+			"The 'z' key switches to nearest and back.")
+	flag.StringVar(&flagPixelAspect, "pixel-aspect", "",
+		"The ratio of the width to the height of the pixels, as a number "+
+			"or W:H, e.g. 10:11. By default, the ratio recorded in the "+
+			"image files is used, if any, and pixels are square otherwise.")
+	flag.StringVar(&flagMoveTo, "move-to", "",
+		"The directory the current image is moved to when pressing 'v'.")
+	flag.StringVar(&flagMarksOut, "marks-out", "",
+		"The file the paths of the images marked with 'b' are written to "+
+			"on exit (stdout by default).")
+	flag.StringVar(&flagExportThumbs, "export-thumbs", "",
+		"If set, thumbnails of the images are written to this directory, "+
+			"and iview exits without displaying them. See -thumb-size.")
+	flag.IntVar(&flagThumbSize, "thumb-size", 256,
+		"The maximum width and height of the thumbnails exported with "+
+			"-export-thumbs.")
+	flag.BoolVar(&flagSync, "sync", false,
+		"If set, panning and zooming in a window does the same in the "+
+			"other windows (see the 'n' key).")
+	flag.DurationVar(&flagTimeout, "timeout", 30*time.Second,
+		"How long fetching an image given as an http or https URL may "+
+			"take, or 0 for no limit.")
+	flag.BoolVar(&flagNoCache, "no-cache", false,
+		"If set, the images given as URLs are always fetched, instead of "+
+			"being read from the cache of the previous runs.")
+	flag.DurationVar(&flagURLTTL, "url-ttl", 7*24*time.Hour,
+		"How long the images fetched from URLs are kept in the cache.")
+	flag.BoolVar(&flagAllowDups, "allow-dups", false,
+		"If set, a file given several times, e.g. explicitly and through "+
+			"its directory, is displayed as many times.")
+	flag.StringVar(&flagPlaylist, "playlist", "",
+		"A file listing the images to display, one per line, in order. "+
+			"Blank lines and lines starting with '#' are skipped, and "+
+			"relative paths are relative to the directory of the file.")
+	flag.StringVar(&flagRaw, "raw", "",
+		"If set, as WxH, a raw image of this size is read from stdin and "+
+			"displayed. See -pixfmt.")
+	flag.StringVar(&flagPixFmt, "pixfmt", "rgba",
+		"The format of the pixels of the -raw image: rgba (8 bits per "+
+			"channel) or gray (8 bits).")
+	flag.BoolVar(&flagPick, "pick", false,
+		"If set, a file dialog is opened to pick an image when none is "+
+			"given.")
+	flag.BoolVar(&flagList, "list", false,
+		"If set, the files that would be displayed are printed to stdout, "+
+			"in order, and iview exits.")
 	flag.Usage = usage
+}
+
+// parseFlags parses the command line, and checks the values of the flags.
+// It is called by main, rather than init, so that the package can be
+// tested.
+func parseFlags() {
 	flag.Parse()
 
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "width" || f.Name == "height" {
+			sizeGiven = true
+		}
+	})
+
 	// Do some error checking on the flag values... naughty!
 	if flagWidth == 0 || flagHeight == 0 {
 		log.Fatal("The width and height must be non-zero values.")
 	}
+	if flagMinWidth < 0 || flagMinHeight < 0 {
+		log.Fatal("The minimum width and height can't be negative.")
+	}
+	if flagThumbSize < 1 {
+		log.Fatal("The size of the thumbnails must be positive.")
+	}
+	if flagTimeout < 0 {
+		log.Fatal("The timeout can't be negative.")
+	}
+	if flagURLTTL <= 0 {
+		log.Fatal("The time the fetched images are cached must be positive.")
+	}
+	if flagZoom <= 0 {
+		log.Fatal("The zoom factor must be positive.")
+	}
+	if flagQuality < 1 || flagQuality > 100 {
+		log.Fatal("The JPEG quality must be between 1 and 100.")
+	}
+	if flagPanAccel < 1 {
+		log.Fatal("The panning acceleration must be at least 1.")
+	}
+	if flagCacheSize < 1 {
+		log.Fatal("The cache size must be at least 1.")
+	}
+	if flagJobs < 0 {
+		log.Fatal("The number of jobs can't be negative.")
+	}
+	if len(flagMatch) > 0 {
+		var err error
+		matchRe, err = regexp.Compile(flagMatch)
+		if err != nil {
+			log.Fatalf("Invalid -match regular expression: %v", err)
+		}
+	}
+	switch flagSort {
+	case "name", "mtime", "size":
+	default:
+		log.Fatalf("Invalid -sort order %q: must be name, mtime or size.",
+			flagSort)
+	}
+	if flagMoveTo != "" {
+		if fi, err := os.Stat(flagMoveTo); err != nil || !fi.IsDir() {
+			log.Fatalf("Invalid -move-to directory %q.", flagMoveTo)
+		}
+	}
+	if flagRaw != "" {
+		var w, h int
+		if _, err := fmt.Sscanf(flagRaw, "%dx%d", &w, &h); err != nil || w <= 0 || h <= 0 {
+			log.Fatalf("Invalid -raw size %q: must be WxH.", flagRaw)
+		}
+		rawSize = image.Point{w, h}
+	}
+	if flagPixelAspect != "" {
+		var err error
+		pixelAspect, err = parseAspect(flagPixelAspect)
+		if err != nil {
+			log.Fatalf("Invalid -pixel-aspect %q: must be a positive number or W:H.",
+				flagPixelAspect)
+		}
+	}
+	switch flagPixFmt {
+	case "rgba", "gray":
+	default:
+		log.Fatalf("Invalid -pixfmt %q: must be rgba or gray.", flagPixFmt)
+	}
+	if flagBackground != "" {
+		col, err := parseColor(flagBackground)
+		if err != nil {
+			log.Fatalf("Invalid -bg color: %v", err)
+		}
+		bkgCol = col
+	}
 }
 
 func usage() {
 	fmt.Fprintf(os.Stderr, "Usage: %s [flags] image-file [image-file ...]\n",
 		basename(os.Args[0]))
+	fmt.Fprintf(os.Stderr, "       %s [flags] - < image-list\n",
+		basename(os.Args[0]))
+	fmt.Fprintf(os.Stderr, "       %s [flags] -playlist image-list\n",
+		basename(os.Args[0]))
+	fmt.Fprintf(os.Stderr, "       %s [flags] -raw WxH < pixels\n",
+		basename(os.Args[0]))
 	flag.PrintDefaults()
 	os.Exit(1)
 }
 
 func main() {
+	parseFlags()
+
 	// Run the CPU profile if we're instructed to.
 	if len(flagProfile) > 0 {
 		f, err := os.Create(flagProfile)
@@ -87,209 +443,504 @@ func main() {
 		pprof.StartCPUProfile(f)
 		defer pprof.StopCPUProfile()
 	}
+	if len(flagMemProfile) > 0 {
+		defer writeMemProfile(flagMemProfile)
+	}
+
+	args := flag.Args()
+	// -playlist and -raw give the images to display themselves.
+	given := flagPlaylist != "" || flagRaw != ""
+	if given && len(args) > 0 {
+		log.Fatal("No images can be given along with -playlist or -raw.")
+	}
+	if len(args) == 0 && flagPick && !given {
+		// Let the user pick an image instead.
+		fName, err := pickFile()
+		if errors.Is(err, dialog.ErrCancelled) {
+			return
+		}
+		if err != nil {
+			log.Fatalf("Could not pick an image: %v", err)
+		}
+		args = []string{fName}
+	}
 
 	// Whoops!
-	if flag.NArg() == 0 {
+	if len(args) == 0 && !given {
 		fmt.Fprint(os.Stderr, "\n")
 		log.Print("No images specified.\n\n")
 		usage()
 	}
 
-	driver.Main(func(s screen.Screen) {
-		// Decode all images (in parallel).
-		names, imgs := decodeImages(findFiles(flag.Args()))
-
-		// Die now if we don't have any images!
-		if len(imgs) == 0 {
-			log.Fatal("No images specified could be shown. Quitting...")
+	// A leading "-" reads the list of images from stdin.
+	if len(args) > 0 && args[0] == "-" {
+		paths, err := readPaths(os.Stdin)
+		if err != nil {
+			log.Fatalf("Could not read image paths from stdin: %v", err)
 		}
-
-		winSize := image.Point{flagWidth, flagHeight}
-		// Auto-size the window if appropriate.
-		if flagAutoResize {
-			log.Printf(">>> img[%s]...\n", names[0])
-			b := imgs[0].Bounds()
-			winSize = image.Point{b.Dx(), b.Dy()}
+		if len(paths) == 0 {
+			log.Fatal("No image paths were given on stdin.")
 		}
+		args = append(paths, args[1:]...)
+	}
 
-		w, err := s.NewWindow(&screen.NewWindowOptions{
-			Width:  winSize.X,
-			Height: winSize.Y,
-		})
+	var (
+		files []string
+		raw   image.Image
+	)
+	switch {
+	case flagRaw != "":
+		img, err := readRaw(os.Stdin, rawSize, flagPixFmt)
+		if err != nil {
+			log.Fatalf("Could not read the raw image from stdin: %v", err)
+		}
+		files, raw = []string{"stdin"}, img
+	case flagPlaylist != "":
+		paths, err := readPlaylist(flagPlaylist)
+		if err != nil {
+			log.Fatalf("Could not read the playlist: %v", err)
+		}
+		if len(paths) == 0 {
+			log.Fatalf("No images are listed in %s.", flagPlaylist)
+		}
+		files = paths
+	default:
+		files = findFiles(args)
+	}
+	if flagList {
+		for _, f := range files {
+			fmt.Println(f)
+		}
+		viewer.ReleaseArchives()
+		return
+	}
+	if flagExportThumbs != "" {
+		err := viewer.ExportThumbnails(files, flagExportThumbs, flagThumbSize, flagJobs)
 		if err != nil {
 			log.Fatal(err)
 		}
-		defer w.Release()
+		return
+	}
+
+	keyConfig, err := viewer.KeyConfigPath()
+	if err != nil {
+		log.Print(err)
+	}
+	var geometry string
+	if !flagNoRemember {
+		if geometry, err = viewer.GeometryPath(); err != nil {
+			log.Print(err)
+		}
+	}
+	var urlCache string
+	if !flagNoCache {
+		if urlCache, err = viewer.URLCacheDir(); err != nil {
+			log.Print(err)
+		}
+	}
+	opts := viewer.Options{
+		Files:         files,
+		Image:         raw,
+		Width:         flagWidth,
+		Height:        flagHeight,
+		MinWidth:      flagMinWidth,
+		MinHeight:     flagMinHeight,
+		AutoResize:    flagAutoResize,
+		Center:        flagCenter,
+		Zoom:          flagZoom,
+		StepIncrement: flagStepIncrement,
+		Quality:       flagQuality,
+		CacheSize:     flagCacheSize,
+		Jobs:          flagJobs,
+		Background:    bkgCol,
+		Checker:       flagChecker,
+		KeepFilter:    flagKeepFilter,
+		NoDither:      flagNoDither,
+		LockAspect:    flagLockAspect,
+		SkipErrors:    flagSkipErrors,
+		NoWrap:        flagNoWrap,
+		Once:          flagOnce,
+		ResetView:     flagResetView,
+		UnboundedPan:  flagUnboundedPan,
+		NoMomentum:    flagNoMomentum,
+		MoveTo:        flagMoveTo,
+		Sync:          flagSync,
+		Verbose:       flagVerbose,
+		KeyConfig:     keyConfig,
+		Timeout:       flagTimeout,
+		URLCache:      urlCache,
+		URLCacheTTL:   flagURLTTL,
+		Interp:        flagInterp,
+		Theme:         flagTheme,
+		NoHiDPI:       flagNoHiDPI,
+		PixelAspect:   pixelAspect,
+		FindFiles:     findFiles,
+		GeometryFile:  geometry,
+
+		BackgroundFromImage: flagBgFromImage,
+		PanAcceleration:     flagPanAccel,
+		RestoreGeometry:     !sizeGiven,
+	}
 
-		b, err := s.NewBuffer(winSize)
+	driver.Main(func(s screen.Screen) {
+		v, err := viewer.New(s, opts)
 		if err != nil {
-			log.Fatal(err)
+			log.Fatalf("Could not start the viewer: %v", err)
 		}
-		defer b.Release()
-
-		w.Fill(b.Bounds(), color.White, draw.Src)
-		w.Publish()
-
-		var sz size.Event
-		var i int // index of image to display
-		for {
-			e := w.NextEvent()
-			switch e := e.(type) {
-			default:
-
-			case mouse.Event:
-
-			case key.Event:
-				repaint := false
-				switch e.Code {
-				case key.CodeEscape, key.CodeQ:
-					return
-				case key.CodeRightArrow:
-					if e.Direction == key.DirPress {
-						if i == len(imgs)-1 {
-							i = -1
-						}
-						i++
-						repaint = true
-						b.Release()
-						b, err = s.NewBuffer(sz.Size())
-						if err != nil {
-							log.Fatal(err)
-						}
-					}
-
-				case key.CodeLeftArrow:
-					if e.Direction == key.DirPress {
-						if i == 0 {
-							i = len(imgs)
-						}
-						i--
-						repaint = true
-						b, err = s.NewBuffer(sz.Size())
-						if err != nil {
-							log.Fatal(err)
-						}
-					}
-
-				case key.CodeR:
-					if e.Direction == key.DirPress {
-						// resize to current image
-						r := imgs[i].Bounds()
-						sz.HeightPx = r.Dy()
-						sz.WidthPx = r.Dx()
-						repaint = true
-						b, err = s.NewBuffer(sz.Size())
-						if err != nil {
-							log.Fatal(err)
-						}
-						w.Publish()
-
-					}
-				}
-				if repaint {
-					w.Send(paint.Event{})
-				}
+		// interrupting iview closes its windows, rather than killing it,
+		// so that it cleans up after itself.
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			<-sigs
+			log.Print("Interrupted: quitting...")
+			v.Quit()
+		}()
+
+		v.Run()
+		signal.Stop(sigs)
+		if err := writeMarks(v.Marked()); err != nil {
+			log.Printf("Could not write the marked images: %v", err)
+		}
+	})
+}
 
-			case paint.Event:
-				img := imgs[i]
-				draw.Draw(b.RGBA(), b.Bounds(), img, image.Point{}, draw.Src)
-				dp := vpCenter(img, sz.WidthPx, sz.HeightPx)
-				zero := image.Point{}
-				if dp != zero {
-					w.Fill(sz.Bounds(), color.Black, draw.Src)
-				}
-				w.Upload(dp, b, b.Bounds())
+// writeMarks writes the paths of the marked images, one per line, to the
+// -marks-out file, or to stdout. Nothing is written to stdout when no image
+// was marked.
+func writeMarks(files []string) error {
+	if flagMarksOut == "" {
+		for _, f := range files {
+			fmt.Println(f)
+		}
+		return nil
+	}
 
-			case size.Event:
-				sz = e
+	var buf strings.Builder
+	for _, f := range files {
+		buf.WriteString(f + "\n")
+	}
+	return os.WriteFile(flagMarksOut, []byte(buf.String()), 0o644)
+}
 
-			case error:
-				log.Print(e)
-			}
+// pickFile asks the user to pick an image file in a file dialog.
+func pickFile() (string, error) {
+	exts := make([]string, 0, len(imageExts))
+	for ext := range imageExts {
+		exts = append(exts, strings.TrimPrefix(ext, "."))
+	}
+	sort.Strings(exts)
+	return dialog.File().Title("Open an image").Filter("Images", exts...).Load()
+}
+
+// writeMemProfile writes a heap profile to the named file.
+func writeMemProfile(fName string) {
+	f, err := os.Create(fName)
+	if err != nil {
+		log.Print(err)
+		return
+	}
+	defer f.Close()
+
+	// collect the garbage, so that the profile only holds live objects.
+	runtime.GC()
+	if err := pprof.WriteHeapProfile(f); err != nil {
+		log.Printf("Could not write the heap profile: %v", err)
+	}
+}
+
+// readPaths reads a list of newline-separated paths from r. Blank lines are
+// skipped.
+func readPaths(r io.Reader) ([]string, error) {
+	var paths []string
+	scan := bufio.NewScanner(r)
+	for scan.Scan() {
+		if p := strings.TrimSpace(scan.Text()); p != "" {
+			paths = append(paths, p)
 		}
-	})
+	}
+	return paths, scan.Err()
+}
+
+// readRaw reads an image of the given size from r, made of raw pixels in
+// the format pixfmt: "rgba", with 8 bits per channel, or "gray".
+func readRaw(r io.Reader, size image.Point, pixfmt string) (image.Image, error) {
+	rect := image.Rectangle{Max: size}
+	var (
+		img image.Image
+		pix []byte
+	)
+	switch pixfmt {
+	case "rgba":
+		m := image.NewRGBA(rect)
+		img, pix = m, m.Pix
+	case "gray":
+		m := image.NewGray(rect)
+		img, pix = m, m.Pix
+	default:
+		return nil, fmt.Errorf("unknown pixel format %q", pixfmt)
+	}
+	if _, err := io.ReadFull(r, pix); err != nil {
+		return nil, fmt.Errorf("%d bytes expected: %w", len(pix), err)
+	}
+	return img, nil
 }
 
+// readPlaylist reads the paths of the images listed in the playlist file
+// fName, one per line. Blank lines and lines starting with '#' are skipped.
+// Relative paths are resolved against the directory of the playlist.
+func readPlaylist(fName string) ([]string, error) {
+	f, err := os.Open(fName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	lines, err := readPaths(f)
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Dir(fName)
+	paths := lines[:0]
+	for _, p := range lines {
+		if strings.HasPrefix(p, "#") {
+			continue
+		}
+		if !filepath.IsAbs(p) && !viewer.IsURL(p) {
+			p = filepath.Join(dir, p)
+		}
+		paths = append(paths, p)
+	}
+	return paths, nil
+}
+
+// findFiles returns the image files given as arguments, or found in the
+// directories given as arguments, sorted according to -sort. They are
+// followed by the images stored in the archives given as arguments, in the
+// order of the archives, and then by the URLs given as arguments. Unless
+// -allow-dups is set, each file is only returned once.
 func findFiles(args []string) []string {
 	files := []string{}
+	archived := []string{}
+	urls := []string{}
 	for _, f := range args {
+		if viewer.IsURL(f) {
+			urls = append(urls, f)
+			continue
+		}
 		fi, err := os.Stat(f)
 		if err != nil {
 			log.Print("Can't access", f, err)
 		} else if fi.IsDir() {
 			files = append(files, dirImages(f)...)
+		} else if viewer.IsArchive(f) {
+			archived = append(archived, archiveImages(f)...)
 		} else {
 			files = append(files, f)
 		}
 	}
+	sortFiles(files)
+	files = expandPages(files)
+	files = append(files, archived...)
+	files = append(files, urls...)
+	if !flagAllowDups {
+		files = dedup(files)
+	}
 	return files
 }
 
+// dedup removes from files the ones resolving to the same absolute path as
+// a previous one, e.g. given both explicitly and through their directory.
+func dedup(files []string) []string {
+	seen := make(map[string]bool, len(files))
+	uniq := files[:0]
+	for _, f := range files {
+		p, err := filepath.Abs(f)
+		if err != nil || viewer.IsURL(f) {
+			p = f
+		}
+		if r, err := filepath.EvalSymlinks(p); err == nil {
+			p = r
+		}
+		if seen[p] {
+			continue
+		}
+		seen[p] = true
+		uniq = append(uniq, f)
+	}
+	return uniq
+}
+
+// sortFiles sorts files in place, according to the -sort and -reverse
+// flags.
+func sortFiles(files []string) {
+	var stats map[string]os.FileInfo
+	if flagSort != "name" {
+		stats = make(map[string]os.FileInfo, len(files))
+		for _, f := range files {
+			fi, err := os.Stat(f)
+			if err != nil {
+				log.Print(err)
+				continue
+			}
+			stats[f] = fi
+		}
+	}
+
+	less := func(a, b string) bool {
+		fa, fb := stats[a], stats[b]
+		switch {
+		case flagSort == "name" || fa == nil || fb == nil:
+		case flagSort == "mtime" && !fa.ModTime().Equal(fb.ModTime()):
+			return fa.ModTime().Before(fb.ModTime())
+		case flagSort == "size" && fa.Size() != fb.Size():
+			return fa.Size() < fb.Size()
+		}
+		return a < b
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		if flagReverse {
+			return less(files[j], files[i])
+		}
+		return less(files[i], files[j])
+	})
+}
+
 func dirImages(dir string) []string {
+	if flagRecursive {
+		return walkImages(dir)
+	}
 
 	fd, _ := os.Open(dir)
-	fs, _ := fd.Readdirnames(0)
+	names, _ := fd.Readdirnames(0)
 	files := []string{}
-	for _, f := range fs {
-		// TODO filter by regexp
-		if filepath.Ext(f) != "" {
+	for _, f := range names {
+		if isImage(f) && matches(f) {
 			files = append(files, filepath.Join(dir, f))
 		}
 	}
 	return files
 }
 
-// decodeImages takes a list of image files and decodes them into image.Image
-// types. Note that the number of images returned may not be the number of
-// image files passed in. Namely, an image file is skipped if it cannot be
-// read or deocoded into an image type that Go understands.
-func decodeImages(imageFiles []string) ([]string, []image.Image) {
-	// A temporary type used to transport decoded images over channels.
-	type tmpImage struct {
-		img  image.Image
-		name string
-	}
-
-	// Decoded all images specified in parallel.
-	imgChans := make([]chan tmpImage, len(imageFiles))
-	for i, fName := range imageFiles {
-		imgChans[i] = make(chan tmpImage, 0)
-		go func(i int, fName string) {
-			file, err := os.Open(fName)
-			if err != nil {
-				log.Println(err)
-				close(imgChans[i])
-				return
-			}
+// walkImages returns the sorted list of image files found in dir and its
+// subdirectories. Symbolic links to directories are followed, but each
+// directory is only visited once to avoid looping forever.
+func walkImages(dir string) []string {
+	files := []string{}
+	seen := make(map[string]bool)
+
+	// visit reports whether the directory at path wasn't visited yet, and
+	// marks it as visited.
+	visit := func(path string) bool {
+		real, err := filepath.EvalSymlinks(path)
+		if err != nil {
+			log.Print(err)
+			return false
+		}
+		if seen[real] {
+			return false
+		}
+		seen[real] = true
+		return true
+	}
 
-			start := time.Now()
-			img, kind, err := image.Decode(file)
+	var walk func(root string)
+	walk = func(root string) {
+		if !visit(root) {
+			return
+		}
+		filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
 			if err != nil {
-				log.Printf("Could not decode '%s' into a supported image "+
-					"format: %s", fName, err)
-				close(imgChans[i])
-				return
+				log.Print(err)
+				return nil
 			}
-			log.Printf("Decoded '%s' into image type '%s' (%s).",
-				fName, kind, time.Since(start))
-
-			imgChans[i] <- tmpImage{
-				img:  img,
-				name: basename(fName),
+			switch {
+			case d.IsDir():
+				if path != root && !visit(path) {
+					return filepath.SkipDir
+				}
+			case d.Type()&fs.ModeSymlink != 0:
+				fi, err := os.Stat(path)
+				if err != nil {
+					log.Print(err)
+				} else if fi.IsDir() {
+					walk(path)
+				} else if isImage(path) && matches(path) {
+					files = append(files, path)
+				}
+			case isImage(path) && matches(path):
+				files = append(files, path)
 			}
-		}(i, fName)
+			return nil
+		})
 	}
+	walk(dir)
+
+	sort.Strings(files)
+	return files
+}
 
-	// Now collect all the decoded images into a slice of names and a slice
-	// of images.
-	names := make([]string, 0, flag.NArg())
-	imgs := make([]image.Image, 0, flag.NArg())
-	for _, imgChan := range imgChans {
-		if tmpImg, ok := <-imgChan; ok {
-			names = append(names, tmpImg.name)
-			imgs = append(imgs, tmpImg.img)
+// expandPages replaces the multi-page TIFF files of files by their pages,
+// in order.
+func expandPages(files []string) []string {
+	var out []string
+	for _, f := range files {
+		ext := strings.ToLower(filepath.Ext(f))
+		if ext != ".tif" && ext != ".tiff" {
+			out = append(out, f)
+			continue
+		}
+		n, err := viewer.TIFFPages(f)
+		if err != nil || n < 2 {
+			// the errors are reported when the file is decoded.
+			out = append(out, f)
+			continue
+		}
+		for i := 0; i < n; i++ {
+			out = append(out, viewer.PagePath(f, i))
 		}
 	}
+	return out
+}
+
+// archiveImages returns the paths of the images stored in the archive file.
+// Entries which aren't images are skipped.
+func archiveImages(archive string) []string {
+	names, err := viewer.ArchiveEntries(archive, func(name string) bool {
+		return isImage(name) && matches(name)
+	})
+	if err != nil {
+		log.Printf("Can't read the archive '%s': %v", archive, err)
+		return nil
+	}
+	files := make([]string, len(names))
+	for i, name := range names {
+		files[i] = viewer.ArchivePath(archive, name)
+	}
+	return files
+}
+
+// imageExts is the set of file extensions, in lower case, of the image
+// formats that can be decoded.
+var imageExts = map[string]bool{
+	".png":  true,
+	".jpg":  true,
+	".jpeg": true,
+	".gif":  true,
+	".bmp":  true,
+	".tiff": true,
+	".tif":  true,
+	".svg":  true,
+}
+
+// isImage reports whether the named file has the extension of a known image
+// format.
+func isImage(fName string) bool {
+	return imageExts[strings.ToLower(filepath.Ext(fName))]
+}
 
-	return names, imgs
+// matches reports whether the base name of the named file matches the
+// -match regular expression, if any.
+func matches(fName string) bool {
+	return matchRe == nil || matchRe.MatchString(filepath.Base(fName))
 }
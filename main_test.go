@@ -0,0 +1,104 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDedup(t *testing.T) {
+	dir := t.TempDir()
+	img := filepath.Join(dir, "a.png")
+	other := filepath.Join(dir, "b.png")
+	for _, f := range []string{img, other} {
+		if err := os.WriteFile(f, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "link.png")
+	if err := os.Symlink(img, link); err != nil {
+		t.Skipf("no symbolic links: %v", err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	for _, tc := range []struct {
+		name  string
+		files []string
+		want  []string
+	}{
+		{"unique", []string{img, other}, []string{img, other}},
+		{"same path", []string{img, other, img}, []string{img, other}},
+		{"relative", []string{"a.png", img}, []string{"a.png"}},
+		{"dot", []string{img, "./a.png", filepath.Join(dir, ".", "a.png")}, []string{img}},
+		{"dot dot", []string{img, filepath.Join("sub", "..", "a.png")}, []string{img}},
+		{"symbolic link", []string{link, img, other}, []string{link, other}},
+		{"missing", []string{"none.png", "./none.png"}, []string{"none.png"}},
+		{
+			"urls", []string{"http://example.com/a.png", "http://example.com/a.png", "https://example.com/a.png"},
+			[]string{"http://example.com/a.png", "https://example.com/a.png"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := dedup(append([]string(nil), tc.files...))
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("dedup(%q) = %q, want %q", tc.files, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestReadPlaylist(t *testing.T) {
+	dir := t.TempDir()
+	abs := filepath.Join(dir, "abs.png")
+	for _, tc := range []struct {
+		name  string
+		lines []string
+		want  []string
+	}{
+		{"empty", nil, nil},
+		{
+			"relative", []string{"a.png", "sub/b.png"},
+			[]string{filepath.Join(dir, "a.png"), filepath.Join(dir, "sub", "b.png")},
+		},
+		{"absolute", []string{abs}, []string{abs}},
+		{"parent", []string{"../c.png"}, []string{filepath.Join(filepath.Dir(dir), "c.png")}},
+		{"url", []string{"https://example.com/d.png"}, []string{"https://example.com/d.png"}},
+		{"comments", []string{"# a comment", "a.png", "#b.png"}, []string{filepath.Join(dir, "a.png")}},
+		{"blank lines", []string{"", "a.png", "   ", "\t", ""}, []string{filepath.Join(dir, "a.png")}},
+		{"spaces", []string{"  a.png  ", "\t# indented comment"}, []string{filepath.Join(dir, "a.png")}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			list := filepath.Join(dir, "list.txt")
+			data := strings.Join(tc.lines, "\n")
+			if err := os.WriteFile(list, []byte(data), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := readPlaylist(list)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) == 0 && len(tc.want) == 0 {
+				return
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("readPlaylist(%q) = %q, want %q", data, got, tc.want)
+			}
+		})
+	}
+
+	if _, err := readPlaylist(filepath.Join(dir, "none.txt")); err == nil {
+		t.Errorf("readPlaylist of a missing file succeeded")
+	}
+}
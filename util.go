@@ -1,28 +1,13 @@
 package main
 
 import (
-	"image"
+	"fmt"
+	"image/color"
+	"math"
+	"strconv"
 	"strings"
 )
 
-// vpCenter inspects the canvas and image geometry, and determines where the
-// origin of the image should be painted into the canvas.
-// If the image is bigger than the canvas, this is always (0, 0).
-// If the image is the same size, then it is also (0, 0).
-// If a dimension of the image is smaller than the canvas, then:
-// x = (canvas_width - image_width) / 2 and
-// y = (canvas_height - image_height) / 2
-func vpCenter(ximg image.Image, canWidth, canHeight int) image.Point {
-	xmargin, ymargin := 0, 0
-	if ximg.Bounds().Dx() < canWidth {
-		xmargin = (canWidth - ximg.Bounds().Dx()) / 2
-	}
-	if ximg.Bounds().Dy() < canHeight {
-		ymargin = (canHeight - ximg.Bounds().Dy()) / 2
-	}
-	return image.Point{xmargin, ymargin}
-}
-
 // basename retrieves the basename of a file path.
 func basename(fName string) string {
 	if lslash := strings.LastIndex(fName, "/"); lslash != -1 {
@@ -31,16 +16,47 @@ func basename(fName string) string {
 	return fName
 }
 
-func min(a, b int) int {
-	if a < b {
-		return a
+// namedColors are the colors that can be given by name on the command line.
+var namedColors = map[string]color.RGBA{
+	"black": {0x00, 0x00, 0x00, 0xff},
+	"white": {0xff, 0xff, 0xff, 0xff},
+	"gray":  {0x80, 0x80, 0x80, 0xff},
+}
+
+// parseColor parses a color given either by name or as #RRGGBB.
+func parseColor(s string) (color.RGBA, error) {
+	if c, ok := namedColors[strings.ToLower(s)]; ok {
+		return c, nil
+	}
+	if len(s) != 7 || s[0] != '#' {
+		return color.RGBA{}, fmt.Errorf("%q is neither a color name nor #RRGGBB", s)
 	}
-	return b
+	v, err := strconv.ParseUint(s[1:], 16, 32)
+	if err != nil {
+		return color.RGBA{}, fmt.Errorf("%q is not a valid hexadecimal color", s)
+	}
+	return color.RGBA{uint8(v >> 16), uint8(v >> 8), uint8(v), 0xff}, nil
 }
 
-func max(a, b int) int {
-	if a > b {
-		return a
+// parseAspect parses a pixel aspect ratio given either as a number or as
+// W:H.
+func parseAspect(s string) (float64, error) {
+	num, den := s, "1"
+	if i := strings.Index(s, ":"); i >= 0 {
+		num, den = s[:i], s[i+1:]
+	}
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0, err
+	}
+	d, err := strconv.ParseFloat(den, 64)
+	if err != nil {
+		return 0, err
+	}
+	a := n / d
+	// both terms, and their ratio, must be positive and finite.
+	if !(n > 0 && d > 0 && a > 0) || math.IsInf(n, 0) || math.IsInf(d, 0) || math.IsInf(a, 0) {
+		return 0, fmt.Errorf("%q is not a positive ratio", s)
 	}
-	return b
+	return a, nil
 }
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"image/color"
+	"testing"
+)
+
+func TestParseColor(t *testing.T) {
+	for _, tc := range []struct {
+		s    string
+		want color.RGBA
+		err  bool
+	}{
+		{"black", color.RGBA{0x00, 0x00, 0x00, 0xff}, false},
+		{"White", color.RGBA{0xff, 0xff, 0xff, 0xff}, false},
+		{"GRAY", color.RGBA{0x80, 0x80, 0x80, 0xff}, false},
+		{"#102030", color.RGBA{0x10, 0x20, 0x30, 0xff}, false},
+		{"#a0B0c0", color.RGBA{0xa0, 0xb0, 0xc0, 0xff}, false},
+		{"", color.RGBA{}, true},
+		{"red", color.RGBA{}, true},
+		{"102030", color.RGBA{}, true},
+		{"#10203", color.RGBA{}, true},
+		{"#1020304", color.RGBA{}, true},
+		{"#10203g", color.RGBA{}, true},
+		{"#+10203", color.RGBA{}, true},
+		{"# 10203", color.RGBA{}, true},
+	} {
+		t.Run(tc.s, func(t *testing.T) {
+			got, err := parseColor(tc.s)
+			switch {
+			case tc.err && err == nil:
+				t.Errorf("parseColor(%q) = %v, want an error", tc.s, got)
+			case !tc.err && err != nil:
+				t.Errorf("parseColor(%q): %v", tc.s, err)
+			case got != tc.want:
+				t.Errorf("parseColor(%q) = %v, want %v", tc.s, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseAspect(t *testing.T) {
+	for _, tc := range []struct {
+		s    string
+		want float64
+		err  bool
+	}{
+		{"1", 1, false},
+		{"0.9", 0.9, false},
+		{"4:3", 4.0 / 3, false},
+		{"10:11", 10.0 / 11, false},
+		{"1.5:1", 1.5, false},
+		{"", 0, true},
+		{"0", 0, true},
+		{"-1", 0, true},
+		{"wide", 0, true},
+		{"4:", 0, true},
+		{":3", 0, true},
+		{"4:0", 0, true},
+		{"0:3", 0, true},
+		{"-4:3", 0, true},
+		{"4:3:2", 0, true},
+		{"NaN", 0, true},
+		{"Inf", 0, true},
+		{"1:Inf", 0, true},
+		{"1e-300:1e300", 0, true},
+	} {
+		t.Run(tc.s, func(t *testing.T) {
+			got, err := parseAspect(tc.s)
+			switch {
+			case tc.err && err == nil:
+				t.Errorf("parseAspect(%q) = %g, want an error", tc.s, got)
+			case !tc.err && err != nil:
+				t.Errorf("parseAspect(%q): %v", tc.s, err)
+			case got != tc.want:
+				t.Errorf("parseAspect(%q) = %g, want %g", tc.s, got, tc.want)
+			}
+		})
+	}
+}
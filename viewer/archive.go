@@ -0,0 +1,442 @@
+package viewer
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// archiveSep separates the path of an archive from the name of an entry in
+// the paths of the images read from archives, e.g. "comic.cbz!/01.png".
+const archiveSep = "!/"
+
+// ArchivePath returns the path of the image stored as entry in the archive
+// file, as expected in Options.Files.
+func ArchivePath(archive, entry string) string {
+	return archive + archiveSep + entry
+}
+
+// splitArchive splits the path of an image stored in an archive into the
+// path of the archive and the name of the entry. ok is false for the paths
+// of regular files.
+func splitArchive(path string) (archive, entry string, ok bool) {
+	i := strings.Index(path, archiveSep)
+	if i < 0 || !IsArchive(path[:i]) {
+		return "", "", false
+	}
+	return path[:i], path[i+len(archiveSep):], true
+}
+
+// isArchived reports whether path refers to an image stored in an archive.
+func isArchived(path string) bool {
+	_, _, ok := splitArchive(path)
+	return ok
+}
+
+// The supported archive formats.
+const (
+	archiveNone = iota
+	archiveZip
+	archiveTar
+	archiveTarGz
+)
+
+// archiveKind returns the format of the named archive file, guessed from its
+// extension.
+func archiveKind(fName string) int {
+	name := strings.ToLower(fName)
+	switch {
+	case strings.HasSuffix(name, ".zip"), strings.HasSuffix(name, ".cbz"):
+		return archiveZip
+	case strings.HasSuffix(name, ".tar"):
+		return archiveTar
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return archiveTarGz
+	}
+	return archiveNone
+}
+
+// IsArchive reports whether the named file has the extension of a supported
+// archive format: zip, cbz, tar or tar.gz.
+func IsArchive(fName string) bool {
+	return archiveKind(fName) != archiveNone
+}
+
+// ArchiveEntries returns the names of the entries of the archive file for
+// which keep returns true. The entries of zip archives are sorted by name,
+// while the ones of tar archives are kept in the order they are stored.
+// Directories are skipped. The entries of tar.gz archives are decompressed
+// into a temporary file along the way, see ReleaseArchives.
+func ArchiveEntries(archive string, keep func(name string) bool) ([]string, error) {
+	if archiveKind(archive) == archiveZip {
+		r, err := zip.OpenReader(archive)
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+
+		var names []string
+		for _, f := range r.File {
+			if !f.FileInfo().IsDir() && keep(f.Name) {
+				names = append(names, f.Name)
+			}
+		}
+		sort.Strings(names)
+		return names, nil
+	}
+
+	if archiveKind(archive) == archiveTarGz {
+		// the entries are spooled while they are listed, so that they can
+		// be read without decompressing the archive again.
+		s := tarGzSpoolOf(archive, true)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if err := s.spool(archive); err != nil {
+			return nil, err
+		}
+		var names []string
+		for _, name := range s.names {
+			if keep(name) {
+				names = append(names, name)
+			}
+		}
+		return names, nil
+	}
+
+	var names []string
+	err := walkTar(archive, func(hdr *tar.Header, r io.Reader) (bool, error) {
+		if hdr.Typeflag == tar.TypeReg && keep(hdr.Name) {
+			names = append(names, hdr.Name)
+		}
+		return false, nil
+	})
+	return names, err
+}
+
+// walkTar calls f for each entry of the tar archive file, along with a
+// reader of its content, until f returns true. Walking stops, with a log
+// message, at the first entry whose header can't be read.
+func walkTar(archive string, f func(hdr *tar.Header, r io.Reader) (bool, error)) error {
+	file, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var r io.Reader = file
+	if archiveKind(archive) == archiveTarGz {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		switch {
+		case err == io.EOF:
+			return nil
+		case errors.Is(err, tar.ErrHeader), errors.Is(err, tar.ErrFieldTooLong):
+			// the reader can't get past a corrupted header.
+			log.Printf("Skipping the unreadable entries of '%s': %v", archive, err)
+			return nil
+		case err != nil:
+			return err
+		}
+		stop, err := f(hdr, tr)
+		if err != nil || stop {
+			return err
+		}
+	}
+}
+
+// memFile is a file read into memory.
+type memFile struct {
+	*bytes.Reader
+}
+
+func (memFile) Close() error { return nil }
+
+// openFile opens the image file at path, which may be stored in an archive,
+// be a page of a multi-page TIFF file, or be the URL of an image.
+func openFile(path string) (io.ReadSeekCloser, error) {
+	if IsURL(path) {
+		return fetch(path)
+	}
+	if file, page, ok := splitPage(path); ok {
+		return openPage(file, page)
+	}
+	archive, entry, ok := splitArchive(path)
+	if !ok {
+		return os.Open(path)
+	}
+
+	var (
+		buf   []byte
+		found bool
+	)
+	if archiveKind(archive) == archiveZip {
+		r, err := zip.OpenReader(archive)
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		for _, f := range r.File {
+			if f.Name != entry {
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return nil, err
+			}
+			defer rc.Close()
+			if buf, err = io.ReadAll(rc); err != nil {
+				return nil, err
+			}
+			found = true
+			break
+		}
+	} else if archiveKind(archive) == archiveTarGz {
+		if s := tarGzSpoolOf(archive, false); s != nil {
+			return s.open(archive, entry)
+		}
+		// no store uses the archive: it is read once, as other tar
+		// archives are.
+		return openTarEntry(archive, entry)
+	} else {
+		return openTarEntry(archive, entry)
+	}
+	if !found {
+		return nil, fmt.Errorf("%s: no such entry in '%s'", entry, archive)
+	}
+	return memFile{bytes.NewReader(buf)}, nil
+}
+
+// openTarEntry reads the named entry of the tar archive file into memory.
+func openTarEntry(archive, entry string) (io.ReadSeekCloser, error) {
+	var (
+		buf   []byte
+		found bool
+	)
+	err := walkTar(archive, func(hdr *tar.Header, r io.Reader) (bool, error) {
+		if hdr.Name != entry {
+			return false, nil
+		}
+		var err error
+		buf, err = io.ReadAll(r)
+		found = true
+		return true, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("%s: no such entry in '%s'", entry, archive)
+	}
+	return memFile{bytes.NewReader(buf)}, nil
+}
+
+// tarGzSpool holds the regular entries of a tar.gz archive, decompressed
+// into a temporary file when the archive is first listed or read, so that
+// reading an entry doesn't mean decompressing the archive from its start
+// again. The spools live as long as the image stores using their archive,
+// see retainArchives.
+type tarGzSpool struct {
+	refs int // number of stores using the spool, guarded by tarGzSpools
+
+	mu      sync.Mutex
+	spooled bool // whether the archive was spooled, or failed to be
+	f       *os.File
+	names   []string // names of the regular entries, in order
+	entries map[string]tarGzEntry
+	err     error // why the archive couldn't be spooled, if it couldn't
+}
+
+// tarGzEntry locates the content of an entry in the file of a tarGzSpool.
+type tarGzEntry struct {
+	off, size int64
+}
+
+// tarGzSpools holds the spools of the tar.gz archives, by path. Its lock
+// only guards the map and the reference counts: each spool is filled and
+// read under its own lock.
+var tarGzSpools = struct {
+	sync.Mutex
+	m map[string]*tarGzSpool
+}{m: make(map[string]*tarGzSpool)}
+
+// tarGzSpoolOf returns the spool of the tar.gz archive, adding an empty one
+// if create is true and there is none. It returns nil otherwise.
+func tarGzSpoolOf(archive string, create bool) *tarGzSpool {
+	tarGzSpools.Lock()
+	defer tarGzSpools.Unlock()
+	s := tarGzSpools.m[archive]
+	if s == nil && create {
+		s = new(tarGzSpool)
+		tarGzSpools.m[archive] = s
+	}
+	return s
+}
+
+// retainArchives marks the tar.gz archives holding some of the image files
+// as used, so that their spools are kept until releaseArchives is called
+// with the archives it returns.
+func retainArchives(files []string) []string {
+	tarGzSpools.Lock()
+	defer tarGzSpools.Unlock()
+	var archives []string
+	seen := make(map[string]bool)
+	for _, f := range files {
+		archive, _, ok := splitArchive(f)
+		if !ok || seen[archive] || archiveKind(archive) != archiveTarGz {
+			continue
+		}
+		seen[archive] = true
+		s := tarGzSpools.m[archive]
+		if s == nil {
+			s = new(tarGzSpool)
+			tarGzSpools.m[archive] = s
+		}
+		s.refs++
+		archives = append(archives, archive)
+	}
+	return archives
+}
+
+// releaseArchives releases the archives returned by retainArchives, and
+// removes the spools no longer used.
+func releaseArchives(archives []string) {
+	var unused []*tarGzSpool
+	tarGzSpools.Lock()
+	for _, archive := range archives {
+		s := tarGzSpools.m[archive]
+		if s == nil {
+			continue
+		}
+		if s.refs--; s.refs <= 0 {
+			delete(tarGzSpools.m, archive)
+			unused = append(unused, s)
+		}
+	}
+	tarGzSpools.Unlock()
+	for _, s := range unused {
+		s.close()
+	}
+}
+
+// ReleaseArchives removes the temporary files of the tar.gz archives listed
+// by ArchiveEntries which aren't used by a viewer, e.g. when the images are
+// only listed.
+func ReleaseArchives() {
+	var unused []*tarGzSpool
+	tarGzSpools.Lock()
+	for archive, s := range tarGzSpools.m {
+		if s.refs <= 0 {
+			delete(tarGzSpools.m, archive)
+			unused = append(unused, s)
+		}
+	}
+	tarGzSpools.Unlock()
+	for _, s := range unused {
+		s.close()
+	}
+}
+
+// spool decompresses the regular entries of the tar.gz archive into a
+// temporary file, unless it was already done. s.mu must be held by the
+// caller.
+func (s *tarGzSpool) spool(archive string) error {
+	if s.spooled {
+		return s.err
+	}
+	s.spooled = true
+	s.err = s.fill(archive)
+	if s.err != nil && s.f != nil {
+		s.remove()
+	}
+	return s.err
+}
+
+// fill copies the content of the regular entries of the archive, one after
+// the other, into a temporary file.
+func (s *tarGzSpool) fill(archive string) error {
+	var err error
+	if s.f, err = os.CreateTemp("", "iview-*.tar"); err != nil {
+		return err
+	}
+	s.entries = make(map[string]tarGzEntry)
+	var off int64
+	return walkTar(archive, func(hdr *tar.Header, r io.Reader) (bool, error) {
+		if hdr.Typeflag != tar.TypeReg {
+			return false, nil
+		}
+		n, err := io.Copy(s.f, r)
+		if err != nil {
+			return true, err
+		}
+		if _, ok := s.entries[hdr.Name]; !ok {
+			s.names = append(s.names, hdr.Name)
+		}
+		// the last entry of a name wins, as when the archive is extracted.
+		s.entries[hdr.Name] = tarGzEntry{off: off, size: n}
+		off += n
+		return false, nil
+	})
+}
+
+// open reads the named entry of the archive into memory, spooling the
+// archive first if needed.
+func (s *tarGzSpool) open(archive, entry string) (io.ReadSeekCloser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.spool(archive); err != nil {
+		return nil, err
+	}
+	if s.f == nil {
+		// the spool was released meanwhile.
+		return openTarEntry(archive, entry)
+	}
+	e, ok := s.entries[entry]
+	if !ok {
+		return nil, fmt.Errorf("%s: no such entry in '%s'", entry, archive)
+	}
+	buf := make([]byte, e.size)
+	if _, err := s.f.ReadAt(buf, e.off); err != nil {
+		return nil, err
+	}
+	return memFile{bytes.NewReader(buf)}, nil
+}
+
+// close removes the temporary file of the spool. The spool is then empty.
+func (s *tarGzSpool) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.spooled = true
+	if s.f != nil {
+		s.remove()
+	}
+}
+
+// remove closes and removes the temporary file of the spool, in that order
+// for the systems which can't remove open files. s.mu must be held by the
+// caller.
+func (s *tarGzSpool) remove() {
+	name := s.f.Name()
+	s.f.Close()
+	os.Remove(name)
+	s.f = nil
+	s.names = nil
+	s.entries = nil
+}
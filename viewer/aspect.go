@@ -0,0 +1,61 @@
+package viewer
+
+import (
+	"image"
+	"math"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+// pixelAspect returns the ratio of the width to the height of the pixels of
+// the current image: Options.PixelAspect if set, or else the one recorded
+// in its file, or 1 for square pixels.
+func (w *window) pixelAspect() float64 {
+	if a := w.opts.PixelAspect; a > 0 {
+		return a
+	}
+	a := w.store.aspect(w.i)
+	if a <= 0 {
+		return 1
+	}
+	if w.unoriented && w.store.orientation(w.i) >= 5 {
+		// the pixels are back on their side.
+		a = 1 / a
+	}
+	return a
+}
+
+// stretchCache holds the last image stretched to square pixels, so that it
+// is only computed once.
+type stretchCache struct {
+	src    image.Image
+	aspect float64
+	interp interp
+	dst    image.Image
+}
+
+// stretched returns img, the current image, resampled so that its pixels
+// are square, leaving the rest of the display path unaware of their shape.
+// The image only ever grows, along the dimension where its pixels are the
+// longest.
+func (w *window) stretched(img image.Image) image.Image {
+	a := w.pixelAspect()
+	if math.Abs(a-1) < 1e-3 {
+		return img
+	}
+	c := &w.stretchCache
+	if c.src == img && c.aspect == a && c.interp == w.interp {
+		return c.dst
+	}
+	b := img.Bounds()
+	sz := b.Size()
+	if a > 1 {
+		sz.X = int(math.Round(float64(sz.X) * a))
+	} else {
+		sz.Y = int(math.Round(float64(sz.Y) / a))
+	}
+	dst := newRGBA(img, image.Rectangle{Max: sz})
+	w.interp.interpolator().Scale(dst, dst.Bounds(), img, b, xdraw.Src, nil)
+	*c = stretchCache{src: img, aspect: a, interp: w.interp, dst: dst}
+	return dst
+}
@@ -0,0 +1,130 @@
+package viewer
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+
+	"golang.org/x/exp/shiny/screen"
+	"golang.org/x/image/math/f64"
+	"golang.org/x/mobile/event/size"
+)
+
+// fakeScreen is an offscreen screen.Screen, whose buffers live in memory
+// and whose windows discard what they are sent. It has no textures, so
+// that the images are composited on the CPU.
+type fakeScreen struct{}
+
+func (fakeScreen) NewBuffer(size image.Point) (screen.Buffer, error) {
+	return &fakeBuffer{image.NewRGBA(image.Rectangle{Max: size})}, nil
+}
+
+func (fakeScreen) NewTexture(size image.Point) (screen.Texture, error) {
+	return nil, errors.New("no textures")
+}
+
+func (fakeScreen) NewWindow(opts *screen.NewWindowOptions) (screen.Window, error) {
+	return fakeWindow{}, nil
+}
+
+type fakeBuffer struct {
+	rgba *image.RGBA
+}
+
+func (b *fakeBuffer) Release()                {}
+func (b *fakeBuffer) Size() image.Point       { return b.rgba.Rect.Size() }
+func (b *fakeBuffer) Bounds() image.Rectangle { return b.rgba.Rect }
+func (b *fakeBuffer) RGBA() *image.RGBA       { return b.rgba }
+
+type fakeWindow struct{}
+
+func (fakeWindow) Release()                                                     {}
+func (fakeWindow) Send(event interface{})                                       {}
+func (fakeWindow) SendFirst(event interface{})                                  {}
+func (fakeWindow) NextEvent() interface{}                                       { return nil }
+func (fakeWindow) Upload(dp image.Point, src screen.Buffer, sr image.Rectangle) {}
+func (fakeWindow) Fill(dr image.Rectangle, src color.Color, op draw.Op)         {}
+func (fakeWindow) Publish() screen.PublishResult                                { return screen.PublishResult{} }
+
+func (fakeWindow) Draw(src2dst f64.Aff3, src screen.Texture, sr image.Rectangle, op draw.Op, opts *screen.DrawOptions) {
+}
+
+func (fakeWindow) DrawUniform(src2dst f64.Aff3, src color.Color, sr image.Rectangle, op draw.Op, opts *screen.DrawOptions) {
+}
+
+func (fakeWindow) Copy(dp image.Point, src screen.Texture, sr image.Rectangle, op draw.Op, opts *screen.DrawOptions) {
+}
+
+func (fakeWindow) Scale(dr image.Rectangle, src screen.Texture, sr image.Rectangle, op draw.Op, opts *screen.DrawOptions) {
+}
+
+// benchSizes are representative sizes of the images displayed: a small
+// picture, a screenshot and a photo.
+var benchSizes = []image.Point{
+	{640, 480},
+	{1920, 1080},
+	{4000, 3000},
+}
+
+// benchWindow returns a window of 800x600 pixels, on a fakeScreen,
+// displaying a gradient of the given size at the given zoom.
+func benchWindow(tb testing.TB, sz image.Point, zoom float64) *window {
+	img := image.NewRGBA(image.Rectangle{Max: sz})
+	for y := 0; y < sz.Y; y++ {
+		for x := 0; x < sz.X; x++ {
+			img.SetRGBA(x, y, color.RGBA{uint8(x), uint8(y), uint8(x ^ y), 0xff})
+		}
+	}
+	store := newImageStore([]string{"bench"}, 1, 1)
+	store.setVirtual(0, img)
+
+	opts := Options{Zoom: zoom}.withDefaults()
+	w, err := newWindow(fakeScreen{}, store, image.Point{800, 600}, opts, defaultBindings())
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(w.release)
+	w.sz = size.Event{WidthPx: 800, HeightPx: 600}
+	w.newBuffer()
+	return w
+}
+
+func BenchmarkDisplay(b *testing.B) {
+	for _, sz := range benchSizes {
+		for _, zoom := range []float64{0.5, 1, 2} {
+			b.Run(fmt.Sprintf("%dx%d/zoom=%g", sz.X, sz.Y, zoom), func(b *testing.B) {
+				w := benchWindow(b, sz, zoom)
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					// the frame is composited again, rather than uploaded
+					// as it was.
+					w.frameOK = false
+					w.display()
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkScale(b *testing.B) {
+	for _, sz := range benchSizes {
+		for _, ip := range []interp{interpDefault, interpNearest, interpBiLinear, interpCatmullRom} {
+			for _, zoom := range []float64{0.5, 2} {
+				b.Run(fmt.Sprintf("%dx%d/%s/zoom=%g", sz.X, sz.Y, ip, zoom), func(b *testing.B) {
+					w := benchWindow(b, sz, zoom)
+					w.interp = ip
+					img := w.img()
+					sr, dr := w.visible(img)
+					dst := w.canvas()
+					b.ResetTimer()
+					for i := 0; i < b.N; i++ {
+						w.scaler(img).Scale(dst, dr, img, sr, draw.Src, nil)
+					}
+				})
+			}
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package viewer
+
+import (
+	"image"
+	"image/draw"
+	"log"
+	"math"
+
+	"golang.org/x/mobile/event/key"
+	"golang.org/x/mobile/event/paint"
+)
+
+// toggleCrop enters or leaves the crop mode, where the area to crop the
+// current image to is selected with the mouse.
+func (w *window) toggleCrop() {
+	w.cropping, w.selecting, w.sel = !w.cropping, false, image.Rectangle{}
+	if w.cropping {
+		w.stopGlide()
+		w.setCursor("crosshair")
+		log.Print("Drag the area to crop to, then press Enter, or Escape to cancel.")
+	} else {
+		w.setCursor("default")
+	}
+}
+
+// cropKey handles the keys of the crop mode: Enter crops the image to the
+// selection, and Escape leaves the mode. It returns false if e isn't such a
+// key, or if the window isn't in crop mode.
+func (w *window) cropKey(e key.Event) bool {
+	if !w.cropping {
+		return false
+	}
+	switch e.Code {
+	case key.CodeEscape:
+		w.toggleCrop()
+	case key.CodeReturnEnter, key.CodeKeypadEnter:
+		w.crop()
+		w.w.Send(paint.Event{})
+	default:
+		return false
+	}
+	return true
+}
+
+// cropPoint returns the pixel of img displayed at the window position pos,
+// or the closest one when pos is outside of the image.
+func (w *window) cropPoint(img image.Image, pos image.Point) image.Point {
+	b := img.Bounds()
+	full := w.dst(img)
+	zx := float64(full.Dx()) / float64(b.Dx())
+	zy := float64(full.Dy()) / float64(b.Dy())
+	p := image.Point{
+		b.Min.X + int(math.Floor(float64(pos.X-full.Min.X)/zx)),
+		b.Min.Y + int(math.Floor(float64(pos.Y-full.Min.Y)/zy)),
+	}
+	p.X = max(b.Min.X, min(p.X, b.Max.X-1))
+	p.Y = max(b.Min.Y, min(p.Y, b.Max.Y-1))
+	return p
+}
+
+// selectTo extends the selection, from the pixel where the drag started, to
+// the one at the window position pos. Both pixels are part of it.
+func (w *window) selectTo(pos image.Point) {
+	img := w.img()
+	p := w.cropPoint(img, pos)
+	r := image.Rectangle{w.selStart, p}.Canon()
+	r.Max = r.Max.Add(image.Pt(1, 1))
+	w.sel = r.Intersect(img.Bounds())
+}
+
+// crop crops the current image to the selection, and leaves the crop mode.
+// The cropped image replaces the decoded one, as the other transformations
+// do, so that it can be saved.
+func (w *window) crop() {
+	sel := w.sel
+	w.toggleCrop()
+	if sel.Dx() < 2 || sel.Dy() < 2 {
+		log.Print("Nothing to crop to: select an area with the mouse first.")
+		return
+	}
+	if w.unoriented {
+		log.Print("Can't crop while the EXIF orientation is undone.")
+		return
+	}
+	// the selection is in the pixels displayed, which may have been
+	// stretched to make them square.
+	shown := w.img().Bounds()
+	w.transform(func(img image.Image) image.Image {
+		b := img.Bounds()
+		sx := float64(b.Dx()) / float64(shown.Dx())
+		sy := float64(b.Dy()) / float64(shown.Dy())
+		r := image.Rect(
+			b.Min.X+int(math.Floor(float64(sel.Min.X-shown.Min.X)*sx)),
+			b.Min.Y+int(math.Floor(float64(sel.Min.Y-shown.Min.Y)*sy)),
+			b.Min.X+int(math.Ceil(float64(sel.Max.X-shown.Min.X)*sx)),
+			b.Min.Y+int(math.Ceil(float64(sel.Max.Y-shown.Min.Y)*sy)),
+		).Intersect(b)
+		if s, ok := img.(interface {
+			SubImage(r image.Rectangle) image.Image
+		}); ok {
+			return s.SubImage(r)
+		}
+		return toRGBA(img).SubImage(r.Sub(b.Min))
+	})
+	w.orig = image.Point{}
+}
+
+// drawSelection draws the outline of the area selected to crop img, the
+// current image, to, and shades the rest of the image.
+func (w *window) drawSelection(dst draw.Image, img image.Image) {
+	if w.sel.Empty() {
+		return
+	}
+	b := img.Bounds()
+	full := w.dst(img)
+	zx := float64(full.Dx()) / float64(b.Dx())
+	zy := float64(full.Dy()) / float64(b.Dy())
+	r := image.Rect(
+		full.Min.X+int(math.Round(float64(w.sel.Min.X-b.Min.X)*zx)),
+		full.Min.Y+int(math.Round(float64(w.sel.Min.Y-b.Min.Y)*zy)),
+		full.Min.X+int(math.Round(float64(w.sel.Max.X-b.Min.X)*zx)),
+		full.Min.Y+int(math.Round(float64(w.sel.Max.Y-b.Min.Y)*zy)),
+	)
+
+	shade := image.NewUniform(overlayBg)
+	vis := full.Intersect(dst.Bounds())
+	for _, s := range []image.Rectangle{
+		{vis.Min, image.Pt(vis.Max.X, r.Min.Y)},
+		{image.Pt(vis.Min.X, r.Max.Y), vis.Max},
+		{image.Pt(vis.Min.X, r.Min.Y), image.Pt(r.Min.X, r.Max.Y)},
+		{image.Pt(r.Max.X, r.Min.Y), image.Pt(vis.Max.X, r.Max.Y)},
+	} {
+		draw.Draw(dst, s.Intersect(vis), shade, image.Point{}, draw.Over)
+	}
+
+	line := image.NewUniform(overlayFg)
+	t := w.textScale()
+	for _, s := range []image.Rectangle{
+		{r.Min, image.Pt(r.Max.X, r.Min.Y+t)},
+		{image.Pt(r.Min.X, r.Max.Y-t), r.Max},
+		{r.Min, image.Pt(r.Min.X+t, r.Max.Y)},
+		{image.Pt(r.Max.X-t, r.Min.Y), r.Max},
+	} {
+		draw.Draw(dst, s.Intersect(dst.Bounds()), line, image.Point{}, draw.Src)
+	}
+}
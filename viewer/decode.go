@@ -0,0 +1,84 @@
+package viewer
+
+import (
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rwcarlsen/goexif/exif"
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
+)
+
+// decoded is an image decoded from a file, along with what is known of it.
+type decoded struct {
+	img    image.Image
+	format string // name of the image format
+
+	// orientation is the EXIF orientation applied to img, so that it
+	// displays upright, 1 if none.
+	orientation int
+
+	// aspect is the ratio of the width to the height of the pixels of
+	// img, as recorded in the file, or 0 if unknown.
+	aspect float64
+}
+
+// decodeImage decodes the named image file.
+func decodeImage(fName string) (decoded, error) {
+	file, err := openFile(fName)
+	if err != nil {
+		return decoded{}, err
+	}
+	defer file.Close()
+
+	start := time.Now()
+	if strings.EqualFold(filepath.Ext(fName), ".svg") {
+		img, err := decodeSVG(file)
+		if err != nil {
+			return decoded{}, fmt.Errorf("Could not decode '%s' as SVG: %s", fName, err)
+		}
+		log.Printf("Decoded '%s' into image type 'svg' (%s).",
+			fName, time.Since(start))
+		return decoded{img: img, format: "svg", orientation: 1}, nil
+	}
+
+	img, kind, err := image.Decode(file)
+	if err != nil {
+		return decoded{}, fmt.Errorf("Could not decode '%s' into a supported image "+
+			"format: %s", fName, err)
+	}
+	log.Printf("Decoded '%s' into image type '%s' (%s).",
+		fName, kind, time.Since(start))
+
+	// Phones record the orientation of JPEG pictures in their EXIF data,
+	// rather than rotating the pixels. The resolution recorded along tells
+	// whether the pixels are square.
+	d := decoded{img: img, format: kind, orientation: 1}
+	if kind == "jpeg" || kind == "tiff" {
+		if _, err := file.Seek(0, io.SeekStart); err == nil {
+			if x, err := exif.Decode(file); err == nil && x != nil {
+				d.aspect = exifPixelAspect(x)
+				if kind == "jpeg" {
+					d.orientation = exifOrientation(x)
+				}
+			}
+		}
+	}
+	if o := d.orientation; o != 1 {
+		log.Printf("Applying EXIF orientation %d to '%s'.", o, fName)
+		d.img = orient(d.img, o)
+		if o >= 5 && d.aspect != 0 {
+			// the image was turned sideways, and so were its pixels.
+			d.aspect = 1 / d.aspect
+		}
+	}
+	return d, nil
+}
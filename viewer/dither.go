@@ -0,0 +1,83 @@
+package viewer
+
+import (
+	"image"
+)
+
+// bayer is the 4x4 threshold map of the ordered dithering, in 16ths.
+var bayer = [4][4]uint32{
+	{0, 8, 2, 10},
+	{12, 4, 14, 6},
+	{3, 11, 1, 9},
+	{15, 7, 13, 5},
+}
+
+// ditherCache holds the last image dithered, so that it is only computed
+// once per image.
+type ditherCache struct {
+	src image.Image
+	dst image.Image
+}
+
+// is16Bit reports whether img has 16 bits per channel.
+func is16Bit(img image.Image) bool {
+	switch img.(type) {
+	case *image.RGBA64, *image.NRGBA64, *image.Gray16:
+		return true
+	}
+	return false
+}
+
+// dithered returns img converted to 8 bits per channel with ordered
+// dithering if it has 16 bits per channel, so that smooth gradients don't
+// show bands once drawn into the 8-bit window buffer. Other images are
+// returned as is.
+func (w *window) dithered(img image.Image) image.Image {
+	if w.opts.NoDither || !is16Bit(img) {
+		return img
+	}
+	if w.ditherCache.src == img {
+		return w.ditherCache.dst
+	}
+	dst := dither(img)
+	w.ditherCache = ditherCache{src: img, dst: dst}
+	return dst
+}
+
+// dither converts img to 8 bits per channel, using ordered dithering to
+// spread the precision lost over neighbouring pixels.
+func dither(img image.Image) *image.RGBA {
+	b := img.Bounds()
+	dst := image.NewRGBA(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		row := bayer[y&3]
+		for x := b.Min.X; x < b.Max.X; x++ {
+			t := row[x&3]
+			r, g, bl, a := img.At(x, y).RGBA()
+			a8 := quantize(a, t)
+			i := dst.PixOffset(x, y)
+			p := dst.Pix[i : i+4 : i+4]
+			// colors are premultiplied, so they can't exceed alpha.
+			p[0] = min8(quantize(r, t), a8)
+			p[1] = min8(quantize(g, t), a8)
+			p[2] = min8(quantize(bl, t), a8)
+			p[3] = a8
+		}
+	}
+	return dst
+}
+
+// quantize converts the 16-bit value v to 8 bits, rounding it up or down
+// depending on the threshold t, in 16ths.
+func quantize(v, t uint32) uint8 {
+	// q is v scaled to [0, 255], with 4 bits of fractional part.
+	q := (v*255*16 + 0x7fff) / 0xffff
+	return uint8(min(255, int((q+t)>>4)))
+}
+
+func min8(a, b uint8) uint8 {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,50 @@
+package viewer
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+// gradient16 returns a 16-bit gray gradient, whose steps are finer than
+// the ones of 8 bits per channel.
+func gradient16(w, h int) *image.RGBA64 {
+	img := image.NewRGBA64(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			v := uint16(0x4000 + 0x20*x)
+			img.SetRGBA64(x, y, color.RGBA64{v, v, v, 0xffff})
+		}
+	}
+	return img
+}
+
+func TestDitherTransformed(t *testing.T) {
+	src := gradient16(64, 16)
+	for _, tc := range []struct {
+		name string
+		f    func(image.Image) image.Image
+	}{
+		{"none", func(img image.Image) image.Image { return img }},
+		{"grayscale", grayscale},
+		{"invert", invert},
+		{"rotate", func(img image.Image) image.Image { return rotate90(img, true) }},
+		{"flip", func(img image.Image) image.Image { return flipImage(img, true) }},
+		{"orient", func(img image.Image) image.Image { return orient(img, 7) }},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			img := tc.f(src)
+			if !is16Bit(img) {
+				t.Fatalf("%T lost the 16 bits per channel", img)
+			}
+			// plain truncation, as when drawing into the window buffer.
+			trunc := image.NewRGBA(img.Bounds())
+			draw.Draw(trunc, trunc.Bounds(), img, img.Bounds().Min, draw.Src)
+			if bytes.Equal(dither(img).Pix, trunc.Pix) {
+				t.Errorf("the dithered image is the truncated one")
+			}
+		})
+	}
+}
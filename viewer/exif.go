@@ -0,0 +1,191 @@
+package viewer
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"io"
+	"log"
+
+	"github.com/rwcarlsen/goexif/exif"
+	"github.com/rwcarlsen/goexif/tiff"
+)
+
+// exifOrientation returns the EXIF orientation tag x, or 1 (the identity)
+// when there isn't any.
+func exifOrientation(x *exif.Exif) int {
+	tag, err := x.Get(exif.Orientation)
+	if err != nil {
+		return 1
+	}
+	o, err := tag.Int(0)
+	if err != nil {
+		return 1
+	}
+	return o
+}
+
+// exifPixelAspect returns the ratio of the width to the height of the pixels
+// of the image of the EXIF data x, from its horizontal and vertical
+// resolutions, or 0 if they aren't recorded.
+func exifPixelAspect(x *exif.Exif) float64 {
+	res := func(name exif.FieldName) float64 {
+		tag, err := x.Get(name)
+		if err != nil {
+			return 0
+		}
+		num, den, err := tag.Rat2(0)
+		if err != nil || num <= 0 || den <= 0 {
+			return 0
+		}
+		return float64(num) / float64(den)
+	}
+	xres, yres := res(exif.XResolution), res(exif.YResolution)
+	if xres == 0 || yres == 0 {
+		return 0
+	}
+	// the more pixels per inch horizontally, the narrower they are.
+	return yres / xres
+}
+
+// orient transforms img according to the EXIF orientation o, so that it
+// displays upright.
+func orient(img image.Image, o int) image.Image {
+	switch o {
+	case 2:
+		return flipImage(img, true)
+	case 3:
+		return flipImage(flipImage(img, true), false)
+	case 4:
+		return flipImage(img, false)
+	case 5:
+		return flipImage(rotate90(img, true), true)
+	case 6:
+		return rotate90(img, true)
+	case 7:
+		return flipImage(rotate90(img, false), true)
+	case 8:
+		return rotate90(img, false)
+	}
+	return img
+}
+
+// unorient undoes orient(img, o), giving back the image as stored in its
+// file.
+func unorient(img image.Image, o int) image.Image {
+	switch o {
+	case 6:
+		return orient(img, 8)
+	case 8:
+		return orient(img, 6)
+	}
+	// the other transformations are their own inverse.
+	return orient(img, o)
+}
+
+// orientCache holds the last image whose EXIF orientation was undone, so
+// that it is only computed once.
+type orientCache struct {
+	src image.Image
+	dst image.Image
+}
+
+// toggleOrientation switches the display of the current image between the
+// EXIF orientation, which shows it upright, and the orientation of its
+// pixels, as stored in its file.
+func (w *window) toggleOrientation() {
+	if w.store.orientation(w.i) == 1 {
+		log.Printf("'%s' has no EXIF orientation.", w.store.name(w.i))
+		return
+	}
+	w.unoriented = !w.unoriented
+	// the image changes shape.
+	w.orig = image.Point{}
+}
+
+// oriented returns img, the current image, with its EXIF orientation undone
+// if the user asked for it.
+func (w *window) oriented(img image.Image) image.Image {
+	o := w.store.orientation(w.i)
+	if !w.unoriented || o == 1 {
+		return img
+	}
+	if c := &w.orientCache; c.src == img {
+		return c.dst
+	}
+	w.orientCache = orientCache{src: img, dst: unorient(img, o)}
+	return w.orientCache.dst
+}
+
+// drawOrientation draws, on the left of dst at the height top, a badge
+// telling that the current image was turned upright according to its EXIF
+// orientation, or that it could be.
+func (w *window) drawOrientation(dst draw.Image, top int) {
+	s := "EXIF"
+	if w.unoriented {
+		s = "EXIF off"
+	}
+	b := w.sz.Bounds()
+	at := b.Min.Add(image.Pt(0, top))
+	r := image.Rectangle{Min: at, Max: at.Add(image.Pt(w.textWidth(s), w.textHeight()))}
+	w.drawTextBox(dst, r.Intersect(b), s)
+}
+
+// exifField is a piece of EXIF metadata, in human readable form.
+type exifField struct {
+	name, value string
+}
+
+// exifFields returns the camera, lens and exposure settings recorded in
+// the EXIF data of the image read from r.
+func exifFields(r io.Reader) []exifField {
+	x, err := exif.Decode(r)
+	if err != nil || x == nil {
+		return nil
+	}
+
+	var fields []exifField
+	add := func(name string, fn exif.FieldName, format func(tag *tiff.Tag) (string, error)) {
+		tag, err := x.Get(fn)
+		if err != nil || tag == nil {
+			return
+		}
+		v, err := format(tag)
+		if err != nil || v == "" {
+			return
+		}
+		fields = append(fields, exifField{name, v})
+	}
+	str := func(tag *tiff.Tag) (string, error) { return tag.StringVal() }
+	rat := func(f func(num, den int64) string) func(tag *tiff.Tag) (string, error) {
+		return func(tag *tiff.Tag) (string, error) {
+			num, den, err := tag.Rat2(0)
+			if err != nil || den == 0 {
+				return "", err
+			}
+			return f(num, den), nil
+		}
+	}
+
+	add("camera make", exif.Make, str)
+	add("camera model", exif.Model, str)
+	add("lens", exif.LensModel, str)
+	add("date", exif.DateTimeOriginal, str)
+	add("exposure", exif.ExposureTime, rat(func(num, den int64) string {
+		if num < den {
+			return fmt.Sprintf("%d/%d s", num, den)
+		}
+		return fmt.Sprintf("%g s", float64(num)/float64(den))
+	}))
+	add("aperture", exif.FNumber, rat(func(num, den int64) string {
+		return fmt.Sprintf("f/%.1f", float64(num)/float64(den))
+	}))
+	add("focal length", exif.FocalLength, rat(func(num, den int64) string {
+		return fmt.Sprintf("%g mm", float64(num)/float64(den))
+	}))
+	add("ISO", exif.ISOSpeedRatings, func(tag *tiff.Tag) (string, error) {
+		n, err := tag.Int(0)
+		return fmt.Sprint(n), err
+	})
+	return fields
+}
@@ -0,0 +1,50 @@
+package viewer
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestOrient(t *testing.T) {
+	// a non-square image, whose pixels all differ.
+	const w, h = 3, 2
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetRGBA(x, y, color.RGBA{uint8(x), uint8(y), 0, 0xff})
+		}
+	}
+	tl := img.RGBAAt(0, 0)
+
+	for _, tc := range []struct {
+		o      int
+		size   image.Point
+		corner image.Point // where the top left pixel of img goes
+	}{
+		{1, image.Pt(w, h), image.Pt(0, 0)},
+		{2, image.Pt(w, h), image.Pt(w-1, 0)},
+		{3, image.Pt(w, h), image.Pt(w-1, h-1)},
+		{4, image.Pt(w, h), image.Pt(0, h-1)},
+		{5, image.Pt(h, w), image.Pt(0, 0)},
+		{6, image.Pt(h, w), image.Pt(h-1, 0)},
+		{7, image.Pt(h, w), image.Pt(h-1, w-1)},
+		{8, image.Pt(h, w), image.Pt(0, w-1)},
+	} {
+		t.Run(fmt.Sprint(tc.o), func(t *testing.T) {
+			up := toRGBA(orient(img, tc.o))
+			if sz := up.Bounds().Size(); sz != tc.size {
+				t.Fatalf("oriented size = %v, want %v", sz, tc.size)
+			}
+			if c := up.RGBAAt(tc.corner.X, tc.corner.Y); c != tl {
+				t.Errorf("pixel at %v = %v, want the top left one %v", tc.corner, c, tl)
+			}
+			back := toRGBA(unorient(up, tc.o))
+			if back.Bounds() != img.Bounds() || !bytes.Equal(back.Pix, img.Pix) {
+				t.Errorf("unorient(orient(img)) differs from img")
+			}
+		})
+	}
+}
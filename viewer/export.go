@@ -0,0 +1,96 @@
+package viewer
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// ExportThumbnails writes thumbnails of the image files, scaled down to fit
+// in size x size squares, into the directory dir, without opening any
+// window. Up to jobs files are decoded at once, the number of CPUs if jobs
+// isn't positive. The thumbnails are named after the files, and keep their
+// format when it can be encoded, PNG otherwise. The files which can't be
+// exported are logged and skipped.
+func ExportThumbnails(files []string, dir string, size, jobs int) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	if jobs <= 0 {
+		jobs = runtime.NumCPU()
+	}
+	defer releaseArchives(retainArchives(files))
+
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex // serializes the choice of the thumbnail names
+		failed int
+		paths  = make(chan string)
+		p      = newProgress("Thumbnails", false)
+	)
+	p.setRemaining(len(files))
+	for i := 0; i < jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range paths {
+				if err := exportThumbnail(path, dir, size, &mu); err != nil {
+					log.Printf("Could not export a thumbnail of '%s': %v", path, err)
+					mu.Lock()
+					failed++
+					mu.Unlock()
+				}
+				p.step()
+			}
+		}()
+	}
+	for _, path := range files {
+		paths <- path
+	}
+	close(paths)
+	wg.Wait()
+	p.finish()
+
+	if failed > 0 {
+		return fmt.Errorf("%d of the %d images could not be exported", failed, len(files))
+	}
+	return nil
+}
+
+// exportThumbnail writes the thumbnail of the image file path into dir. mu
+// is held while picking the name of the thumbnail, so that concurrent
+// exports don't overwrite each other.
+func exportThumbnail(path, dir string, size int, mu *sync.Mutex) error {
+	d, err := decodeImage(path)
+	if err != nil {
+		return err
+	}
+	name := basename(path)
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".png", ".jpg", ".jpeg", ".gif", ".bmp", ".tif", ".tiff":
+	default:
+		name = strings.TrimSuffix(name, filepath.Ext(name)) + ".png"
+	}
+
+	var buf bytes.Buffer
+	if err := encodeImage(&buf, thumbnail(d.img, size), name, defaultJPEGQuality); err != nil {
+		return err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	dst, err := freePath(dir, name)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(dst, buf.Bytes(), 0o644); err != nil {
+		return err
+	}
+	log.Printf("Exported a thumbnail of '%s' to '%s'.", path, dst)
+	return nil
+}
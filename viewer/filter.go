@@ -0,0 +1,114 @@
+package viewer
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// filter is a color transformation applied to the displayed image.
+type filter int
+
+const (
+	filterNone filter = iota
+	filterGrayscale
+	filterInvert
+
+	numFilters
+)
+
+func (f filter) String() string {
+	switch f {
+	case filterGrayscale:
+		return "grayscale"
+	case filterInvert:
+		return "inverted"
+	}
+	return "none"
+}
+
+// filterCache holds the result of the last filter applied, so that it is
+// only computed once per image.
+type filterCache struct {
+	f   filter
+	src image.Image
+	dst image.Image
+}
+
+// cycleFilter switches to the next color filter.
+func (w *window) cycleFilter() {
+	w.filter = (w.filter + 1) % numFilters
+}
+
+// filtered returns img with the current color filter applied.
+func (w *window) filtered(img image.Image) image.Image {
+	if w.filter == filterNone {
+		return img
+	}
+	if c := &w.filterCache; c.f == w.filter && c.src == img {
+		return c.dst
+	}
+
+	var dst image.Image
+	switch w.filter {
+	case filterGrayscale:
+		dst = grayscale(img)
+	case filterInvert:
+		dst = invert(img)
+	}
+	w.filterCache = filterCache{f: w.filter, src: img, dst: dst}
+	return dst
+}
+
+// grayscale returns a copy of img converted to shades of gray. The alpha
+// channel of img is preserved, as are its 16 bits per channel, if any.
+func grayscale(img image.Image) image.Image {
+	b := img.Bounds()
+	if is16Bit(img) {
+		dst := image.NewNRGBA64(b)
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				c := color.NRGBA64Model.Convert(img.At(x, y)).(color.NRGBA64)
+				g := color.Gray16Model.Convert(color.NRGBA64{c.R, c.G, c.B, 0xffff}).(color.Gray16)
+				dst.SetNRGBA64(x, y, color.NRGBA64{g.Y, g.Y, g.Y, c.A})
+			}
+		}
+		return dst
+	}
+	dst := image.NewNRGBA(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			g := color.GrayModel.Convert(color.NRGBA{c.R, c.G, c.B, 0xff}).(color.Gray)
+			dst.SetNRGBA(x, y, color.NRGBA{g.Y, g.Y, g.Y, c.A})
+		}
+	}
+	return dst
+}
+
+// invert returns a copy of img with its colors inverted. The alpha channel
+// of img is preserved, as are its 16 bits per channel, if any.
+func invert(img image.Image) image.Image {
+	b := img.Bounds()
+	var (
+		dst draw.Image
+		pix []uint8
+		bpp = 4
+	)
+	if is16Bit(img) {
+		m := image.NewNRGBA64(b)
+		dst, pix, bpp = m, m.Pix, 8
+	} else {
+		m := image.NewNRGBA(b)
+		dst, pix = m, m.Pix
+	}
+	draw.Draw(dst, b, img, b.Min, draw.Src)
+	// inverting each byte of a big-endian 16-bit value inverts the value.
+	for i := 0; i < len(pix); i += bpp {
+		p := pix[i : i+3*bpp/4] // the color channels, but not alpha
+		for j := range p {
+			p[j] = 0xff - p[j]
+		}
+	}
+	return dst
+}
@@ -0,0 +1,80 @@
+package viewer
+
+import (
+	"encoding/json"
+	"errors"
+	"image"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// GeometryPath returns the default path of the file the size and position
+// of the window are remembered in, under the user's configuration directory.
+func GeometryPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "iview", "window.json"), nil
+}
+
+// geometry is the size and position of a window, at the standard density.
+type geometry struct {
+	Width  int `json:"width"`
+	Height int `json:"height"`
+
+	// Position is the position of the top left corner of the window on
+	// the display, or nil if the driver doesn't report it.
+	Position *image.Point `json:"position,omitempty"`
+}
+
+// loadGeometry reads the geometry saved in the file at path. It reports
+// false if there is none, or if it can't be read.
+func loadGeometry(path string) (geometry, bool) {
+	var g geometry
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("Could not restore the window geometry: %v", err)
+		}
+		return g, false
+	}
+	if err := json.Unmarshal(raw, &g); err != nil {
+		log.Printf("Could not restore the window geometry from '%s': %v", path, err)
+		return g, false
+	}
+	return g, g.Width > 0 && g.Height > 0
+}
+
+// saveGeometry saves the size and position of the window to
+// Options.GeometryFile, if set, for the next viewer to restore them.
+func (w *window) saveGeometry() {
+	path := w.opts.GeometryFile
+	if path == "" || w.sz.WidthPx == 0 {
+		return
+	}
+	sz := w.sz.Size()
+	if w.full {
+		sz = w.prevSize
+	}
+	// the size is restored at the density of the display, see updateDPI.
+	sz = sz.Div(max(1, w.dpi))
+	g := geometry{Width: sz.X, Height: sz.Y}
+	if l, ok := w.w.(locator); ok && !w.full {
+		pos := l.Position()
+		g.Position = &pos
+	}
+
+	raw, err := json.Marshal(g)
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(path), 0o755)
+	}
+	if err == nil {
+		err = os.WriteFile(path, raw, 0o644)
+	}
+	if err != nil {
+		log.Printf("Could not save the window geometry: %v", err)
+	}
+}
@@ -0,0 +1,213 @@
+package viewer
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+
+	"golang.org/x/mobile/event/key"
+	"golang.org/x/mobile/event/mouse"
+	"golang.org/x/mobile/event/paint"
+)
+
+// Geometry of the thumbnail grid, in pixels.
+const (
+	thumbSize = 150 // maximum width and height of the thumbnails
+	gridPad   = 10  // space around the thumbnails
+	gridCell  = thumbSize + 2*gridPad
+)
+
+// The colors of the thumbnail grid. They are set by the theme, see useTheme.
+var (
+	gridPending  color.Color = color.RGBA{0x30, 0x30, 0x30, 0xff}
+	gridSelected color.Color = color.RGBA{0x30, 0x80, 0xe0, 0xff}
+)
+
+// gridCols returns the number of columns of the thumbnail grid.
+func (w *window) gridCols() int {
+	return max(1, w.sz.WidthPx/gridCell)
+}
+
+// gridCellRect returns the rectangle, in window coordinates, of the cell of
+// the i-th image.
+func (w *window) gridCellRect(i int) image.Rectangle {
+	cols := w.gridCols()
+	// center the grid horizontally.
+	x0 := (w.sz.WidthPx - cols*gridCell) / 2
+	pt := image.Point{x0 + (i%cols)*gridCell, (i/cols)*gridCell - w.gridTop}
+	return image.Rectangle{pt, pt.Add(image.Point{gridCell, gridCell})}
+}
+
+// gridAt returns the index of the image whose cell is under pt, or -1.
+func (w *window) gridAt(pt image.Point) int {
+	cols := w.gridCols()
+	x0 := (w.sz.WidthPx - cols*gridCell) / 2
+	if pt.X < x0 || pt.X >= x0+cols*gridCell {
+		return -1
+	}
+	i := (pt.Y+w.gridTop)/gridCell*cols + (pt.X-x0)/gridCell
+	if pt.Y+w.gridTop < 0 || i >= w.store.len() {
+		return -1
+	}
+	return i
+}
+
+// scrollGrid scrolls the grid by dy pixels, keeping it within bounds.
+func (w *window) scrollGrid(dy int) {
+	rows := (w.store.len() + w.gridCols() - 1) / w.gridCols()
+	bottom := max(0, rows*gridCell-w.sz.HeightPx)
+	w.gridTop = max(0, min(bottom, w.gridTop+dy))
+}
+
+// showInGrid scrolls the grid so that the cell of the i-th image is
+// visible.
+func (w *window) showInGrid(i int) {
+	r := w.gridCellRect(i)
+	switch {
+	case r.Min.Y < 0:
+		w.scrollGrid(r.Min.Y)
+	case r.Max.Y > w.sz.HeightPx:
+		w.scrollGrid(r.Max.Y - w.sz.HeightPx)
+	}
+}
+
+// toggleGrid switches between the single image and the thumbnail grid
+// views. The view of the image is saved when entering the grid, as the
+// image picked in it, whose view is restored when leaving it, may be
+// another one.
+func (w *window) toggleGrid() {
+	w.grid = !w.grid
+	if w.grid {
+		w.saveView()
+		w.showInGrid(w.i)
+	} else {
+		w.enter(w.i)
+	}
+}
+
+// gridKey handles the key events of the thumbnail grid view.
+// It returns true when the user asked to quit.
+func (w *window) gridKey(e key.Event) bool {
+	if e.Direction != key.DirPress {
+		return false
+	}
+
+	n, cols := w.store.len(), w.gridCols()
+	i := w.i
+	act := w.lookupKey(e)
+	switch {
+	case e.Code == key.CodeEscape, e.Code == key.CodeReturnEnter,
+		e.Code == key.CodeKeypadEnter, act == actGrid:
+		w.toggleGrid()
+	case act == actQuit:
+		return true
+	}
+
+	switch e.Code {
+	case key.CodeRightArrow:
+		i++
+	case key.CodeLeftArrow:
+		i--
+	case key.CodeDownArrow:
+		i += cols
+	case key.CodeUpArrow:
+		i -= cols
+	case key.CodePageDown:
+		i += cols * max(1, w.sz.HeightPx/gridCell)
+	case key.CodePageUp:
+		i -= cols * max(1, w.sz.HeightPx/gridCell)
+	}
+	if w.grid {
+		w.i = max(0, min(n-1, i))
+		w.showInGrid(w.i)
+	}
+	w.w.Send(paint.Event{})
+	return false
+}
+
+// gridMouse handles the mouse events of the thumbnail grid view.
+func (w *window) gridMouse(e mouse.Event) {
+	switch {
+	case e.Button == mouse.ButtonWheelUp && e.Direction != mouse.DirRelease:
+		w.scrollGrid(-gridCell / 2)
+	case e.Button == mouse.ButtonWheelDown && e.Direction != mouse.DirRelease:
+		w.scrollGrid(gridCell / 2)
+	case e.Button == mouse.ButtonLeft && e.Direction == mouse.DirPress:
+		i := w.gridAt(image.Point{int(e.X), int(e.Y)})
+		if i < 0 {
+			return
+		}
+		w.i = i
+		w.toggleGrid()
+	default:
+		return
+	}
+	w.w.Send(paint.Event{})
+}
+
+// displayGrid draws the thumbnails of the visible cells of the grid.
+// Missing thumbnails are generated in the background, and drawn as they
+// become available.
+func (w *window) displayGrid() {
+	w.frameOK = false
+	dst := w.canvas()
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(w.opts.Background), image.Point{}, draw.Src)
+
+	var (
+		missing []int
+		queue   bool // whether some of the missing thumbnails are new
+	)
+	for i, n := 0, w.store.len(); i < n; i++ {
+		r := w.gridCellRect(i)
+		if r.Max.Y <= 0 {
+			continue
+		}
+		if r.Min.Y >= w.sz.HeightPx {
+			break
+		}
+		if i == w.i {
+			draw.Draw(dst, r.Inset(gridPad/2), image.NewUniform(gridSelected),
+				image.Point{}, draw.Src)
+		}
+
+		thumb := w.store.thumbnail(i)
+		if thumb == nil {
+			missing = append(missing, i)
+			queue = queue || !w.queued[w.store.at(i)]
+			draw.Draw(dst, r.Inset(gridPad), image.NewUniform(gridPending),
+				image.Point{}, draw.Src)
+			continue
+		}
+		tr := image.Rectangle{Max: thumb.Bounds().Size()}
+		tr = tr.Add(r.Min).Add(vpCenter(thumb, gridCell, gridCell))
+		draw.Draw(dst, tr, thumb, thumb.Bounds().Min, draw.Over)
+	}
+
+	// the thumbnails of a page are requested once, unless the request
+	// was superseded, e.g. by the thumbnails of another page.
+	if len(missing) > 0 && !w.store.latest(w.queueGen) {
+		queue = true
+	}
+	switch {
+	case queue:
+		if w.thumbs == nil {
+			w.thumbs = newProgress("Thumbnails", w.opts.Verbose)
+		}
+		p := w.thumbs
+		p.setRemaining(len(missing))
+		w.queued = make(map[*entry]bool, len(missing))
+		for _, i := range missing {
+			w.queued[w.store.at(i)] = true
+		}
+		w.queueGen = w.store.makeThumbnails(missing, func() {
+			p.step()
+			w.w.Send(paint.Event{})
+		})
+	case len(missing) == 0 && w.thumbs != nil:
+		w.thumbs.finish()
+		w.thumbs = nil
+		w.queued = nil
+	}
+	w.w.Upload(image.Point{}, w.b, dst.Bounds())
+	w.w.Publish()
+}
@@ -0,0 +1,77 @@
+package viewer
+
+import (
+	"image"
+	"image/draw"
+	"math"
+
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/mobile/event/size"
+)
+
+// basePixelsPerPt is the number of pixels per point of a display of
+// standard density, i.e. of 96 dots per inch.
+const basePixelsPerPt = 96.0 / 72
+
+// dpiScale returns the factor by which the window and its overlay text are
+// enlarged on the display described by e: 1 on displays of standard
+// density, or when Options.NoHiDPI is set.
+func (w *window) dpiScale(e size.Event) int {
+	if w.opts.NoHiDPI || e.PixelsPerPt <= 0 {
+		return 1
+	}
+	return max(1, int(math.Round(float64(e.PixelsPerPt)/basePixelsPerPt)))
+}
+
+// updateDPI records the density of the display the window is on, from its
+// size event e. The first time around, the window is enlarged on high
+// density displays, where it would look tiny otherwise.
+func (w *window) updateDPI(e size.Event) {
+	first := w.dpi == 0
+	w.dpi = w.dpiScale(e)
+	if !first || w.dpi == 1 || w.full {
+		return
+	}
+	r, ok := w.w.(resizer)
+	if !ok {
+		return
+	}
+	sz := e.Size().Mul(w.dpi)
+	r.Resize(sz)
+	if w.opts.Center {
+		w.center(sz)
+	}
+}
+
+// textScale returns the factor by which the overlay text is enlarged.
+func (w *window) textScale() int {
+	return max(1, w.dpi)
+}
+
+// textHeight returns the height of a box holding a line of overlay text,
+// on the display of the window.
+func (w *window) textHeight() int {
+	return textHeight() * w.textScale()
+}
+
+// textWidth returns the width of a box holding the overlay text s, on the
+// display of the window.
+func (w *window) textWidth(s string) int {
+	return (font.MeasureString(overlayFace, s).Ceil() + 2*overlayPad) * w.textScale()
+}
+
+// drawTextBox is like drawTextBox, but enlarges the text to suit the
+// display of the window.
+func (w *window) drawTextBox(dst draw.Image, r image.Rectangle, s string) {
+	k := w.textScale()
+	if k == 1 {
+		drawTextBox(dst, r, s)
+		return
+	}
+	// the box is drawn at the size of a standard display, then blown up.
+	box := image.NewRGBA(image.Rect(0, 0, (r.Dx()+k-1)/k, (r.Dy()+k-1)/k))
+	drawTextBox(box, box.Bounds(), s)
+	dr := image.Rectangle{Min: r.Min, Max: r.Min.Add(box.Bounds().Size().Mul(k))}
+	xdraw.NearestNeighbor.Scale(dst, dr, box, box.Bounds(), draw.Over, nil)
+}
@@ -0,0 +1,80 @@
+package viewer
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+// histHeight is the height, in pixels, of the graph of each channel of the
+// histogram.
+const histHeight = 40
+
+// histogram holds the number of pixels of an image for each of the 256
+// levels of its red, green and blue channels.
+type histogram [3][256]int
+
+// histCache holds the histogram of the last image it was computed for.
+type histCache struct {
+	src  image.Image
+	hist *histogram
+}
+
+// newHistogram computes the histogram of img.
+func newHistogram(img image.Image) *histogram {
+	var h histogram
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			h[0][c.R]++
+			h[1][c.G]++
+			h[2][c.B]++
+		}
+	}
+	return &h
+}
+
+// toggleHistogram toggles the display of the histogram of the image.
+func (w *window) toggleHistogram() {
+	w.histogram = !w.histogram
+}
+
+// drawHistogram draws the histogram of img on the left of dst, from the
+// height top down, enlarged as the overlay text is.
+func (w *window) drawHistogram(dst draw.Image, img image.Image, top int) {
+	if w.histCache.src != img {
+		w.histCache = histCache{src: img, hist: newHistogram(img)}
+	}
+	h := w.histCache.hist
+
+	// the graph is drawn at the size of a standard display, then blown up.
+	box := image.NewRGBA(image.Rect(0, 0, 256+2*overlayPad, 3*histHeight+4*overlayPad))
+	draw.Draw(box, box.Bounds(), image.NewUniform(overlayBg), image.Point{}, draw.Src)
+	colors := [3]color.Color{
+		color.RGBA{0xff, 0x40, 0x40, 0xff},
+		color.RGBA{0x40, 0xff, 0x40, 0xff},
+		color.RGBA{0x40, 0x80, 0xff, 0xff},
+	}
+	for ch := range h {
+		peak := 1
+		for _, n := range h[ch] {
+			peak = max(peak, n)
+		}
+		bottom := overlayPad + (ch+1)*(histHeight+overlayPad)
+		src := image.NewUniform(colors[ch])
+		for lvl, n := range h[ch] {
+			bar := (n*histHeight + peak - 1) / peak
+			x := overlayPad + lvl
+			draw.Draw(box, image.Rect(x, bottom-bar, x+1, bottom), src,
+				image.Point{}, draw.Src)
+		}
+	}
+
+	k := w.textScale()
+	at := w.sz.Bounds().Min.Add(image.Pt(0, top))
+	r := image.Rectangle{Min: at, Max: at.Add(box.Bounds().Size().Mul(k))}
+	xdraw.NearestNeighbor.Scale(dst, r, box, box.Bounds(), draw.Over, nil)
+}
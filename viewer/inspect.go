@@ -0,0 +1,47 @@
+package viewer
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+)
+
+// toggleInspect toggles the display of the pixel under the mouse cursor.
+func (w *window) toggleInspect() {
+	w.inspect = !w.inspect
+}
+
+// imagePoint returns the pixel of img displayed at the window position pos,
+// and whether there is one.
+func (w *window) imagePoint(img image.Image, pos image.Point) (image.Point, bool) {
+	b := img.Bounds()
+	full := w.dst(img)
+	if !pos.In(full) {
+		return image.Point{}, false
+	}
+	zx := float64(full.Dx()) / float64(b.Dx())
+	zy := float64(full.Dy()) / float64(b.Dy())
+	p := image.Point{
+		b.Min.X + int(math.Floor(float64(pos.X-full.Min.X)/zx)),
+		b.Min.Y + int(math.Floor(float64(pos.Y-full.Min.Y)/zy)),
+	}
+	return p, p.In(b)
+}
+
+// drawInspector draws, in the top right corner of dst, the coordinates and
+// the color of the pixel of img under the mouse cursor.
+func (w *window) drawInspector(dst draw.Image, img image.Image) {
+	p, ok := w.imagePoint(img, w.cursor)
+	if !ok {
+		return
+	}
+	c := color.NRGBAModel.Convert(img.At(p.X, p.Y)).(color.NRGBA)
+	s := fmt.Sprintf("(%d, %d)  rgba(%d, %d, %d, %d)", p.X, p.Y, c.R, c.G, c.B, c.A)
+
+	r := w.sz.Bounds()
+	r.Min.X = max(r.Min.X, r.Max.X-w.textWidth(s))
+	r.Max.Y = min(r.Max.Y, r.Min.Y+w.textHeight())
+	w.drawTextBox(dst, r, s)
+}
@@ -0,0 +1,147 @@
+package viewer
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+// interp is the interpolation used to scale the images.
+type interp int
+
+const (
+	// interpDefault is a fast approximation of bilinear interpolation,
+	// which lets the driver scale the image itself where it can. Images
+	// shrunk are smoothed with a Catmull-Rom filter instead.
+	interpDefault interp = iota
+	interpNearest
+	interpBiLinear
+	interpCatmullRom
+)
+
+// parseInterp returns the interpolation named name, as given to
+// Options.Interp.
+func parseInterp(name string) (interp, error) {
+	switch name {
+	case "":
+		return interpDefault, nil
+	case "nearest":
+		return interpNearest, nil
+	case "bilinear":
+		return interpBiLinear, nil
+	case "catmullrom":
+		return interpCatmullRom, nil
+	}
+	return interpDefault, fmt.Errorf(
+		"unknown interpolation %q: must be nearest, bilinear or catmullrom", name)
+}
+
+func (ip interp) String() string {
+	switch ip {
+	case interpNearest:
+		return "nearest"
+	case interpBiLinear:
+		return "bilinear"
+	case interpCatmullRom:
+		return "catmullrom"
+	}
+	return "default"
+}
+
+// interpolator returns the scaler implementing the interpolation.
+func (ip interp) interpolator() xdraw.Interpolator {
+	switch ip {
+	case interpNearest:
+		return xdraw.NearestNeighbor
+	case interpBiLinear:
+		return xdraw.BiLinear
+	case interpCatmullRom:
+		return xdraw.CatmullRom
+	}
+	return xdraw.ApproxBiLinear
+}
+
+// scaler returns the interpolator scaling img to the current zoom. Unless
+// an interpolation was chosen, images are shrunk with a Catmull-Rom filter:
+// the approximation of bilinear interpolation makes them jagged.
+func (w *window) scaler(img image.Image) xdraw.Interpolator {
+	if w.interp == interpDefault && w.scale(img) < 1 {
+		return xdraw.CatmullRom
+	}
+	return w.interp.interpolator()
+}
+
+// toggleInterp switches between nearest neighbor interpolation, which shows
+// the pixels of the image, and the smooth interpolation used otherwise.
+func (w *window) toggleInterp() {
+	if w.interp == interpNearest {
+		w.interp = w.smooth
+		return
+	}
+	w.smooth, w.interp = w.interp, interpNearest
+}
+
+// diffColor is the color highlighting the pixels changed by the
+// interpolation, see drawInterpDiff.
+var diffColor = color.RGBA{0xff, 0x00, 0xff, 0xff}
+
+// toggleInterpDiff toggles the highlighting of the pixels where the
+// interpolation differs from nearest neighbor scaling.
+func (w *window) toggleInterpDiff() {
+	w.interpDiff = !w.interpDiff
+}
+
+// drawInterpDiff highlights the pixels of the part dr of dst, where the part
+// sr of src was scaled into, which differ between the interpolation scaling
+// it and nearest neighbor scaling. The larger the difference, the more
+// opaque the highlight, so that the artifacts of the interpolation stand
+// out, e.g. ringing or blurring along the edges.
+func (w *window) drawInterpDiff(dst *image.RGBA, dr image.Rectangle, img, src image.Image, sr image.Rectangle) {
+	r := dr.Intersect(dst.Bounds())
+	if r.Empty() {
+		return
+	}
+	// both are scaled afresh, rather than compared with dst, which may
+	// hold the image composited over the background.
+	smooth := image.NewRGBA(dr)
+	w.scaler(img).Scale(smooth, dr, src, sr, draw.Src, nil)
+	nearest := image.NewRGBA(dr)
+	xdraw.NearestNeighbor.Scale(nearest, dr, src, sr, draw.Src, nil)
+
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			i, j := smooth.PixOffset(x, y), nearest.PixOffset(x, y)
+			d := 0
+			for c := 0; c < 4; c++ {
+				d = max(d, absDiff(smooth.Pix[i+c], nearest.Pix[j+c]))
+			}
+			if d == 0 {
+				continue
+			}
+			// differences of a quarter of the range are fully highlighted.
+			a := min(255, 4*d)
+			k := dst.PixOffset(x, y)
+			p := dst.Pix[k : k+4 : k+4]
+			p[0] = blend(p[0], diffColor.R, a)
+			p[1] = blend(p[1], diffColor.G, a)
+			p[2] = blend(p[2], diffColor.B, a)
+			p[3] = blend(p[3], diffColor.A, a)
+		}
+	}
+}
+
+// absDiff returns the absolute difference of a and b.
+func absDiff(a, b uint8) int {
+	if a > b {
+		return int(a - b)
+	}
+	return int(b - a)
+}
+
+// blend returns the mix of a and b, with the weight w/255 for b.
+func blend(a, b uint8, w int) uint8 {
+	return uint8((int(a)*(255-w) + int(b)*w + 127) / 255)
+}
@@ -0,0 +1,349 @@
+package viewer
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"golang.org/x/mobile/event/key"
+)
+
+// action is a command of the viewer that can be bound to a key.
+type action string
+
+const (
+	actNone          action = "none"
+	actQuit          action = "quit"
+	actNext          action = "next"
+	actPrev          action = "prev"
+	actFirst         action = "first"
+	actLast          action = "last"
+	actZoomIn        action = "zoom-in"
+	actZoomOut       action = "zoom-out"
+	actFit           action = "fit"
+	actActualSize    action = "actual-size"
+	actResetView     action = "reset-view"
+	actRotateCW      action = "rotate-cw"
+	actRotateCCW     action = "rotate-ccw"
+	actRotateAngle   action = "rotate-angle"
+	actFlipH         action = "flip-horizontal"
+	actFlipV         action = "flip-vertical"
+	actFilter        action = "filter"
+	actPanLeft       action = "pan-left"
+	actPanRight      action = "pan-right"
+	actPanUp         action = "pan-up"
+	actPanDown       action = "pan-down"
+	actDelete        action = "delete"
+	actCopyPath      action = "copy-path"
+	actSave          action = "save"
+	actInfo          action = "info"
+	actMetadata      action = "metadata"
+	actInspect       action = "inspect"
+	actHistogram     action = "histogram"
+	actGrid          action = "grid"
+	actFullscreen    action = "fullscreen"
+	actResizeToImage action = "resize-to-image"
+	actNewWindow     action = "new-window"
+	actMark          action = "mark"
+	actMove          action = "move"
+	actInterp        action = "interp"
+	actOrientation   action = "exif-orientation"
+	actCrop          action = "crop"
+	actInterpDiff    action = "interp-diff"
+)
+
+// actions maps each action to its implementation.
+var actions = map[action]func(w *window){
+	actQuit:          func(w *window) { w.quit = true },
+	actNext:          (*window).next,
+	actPrev:          (*window).prev,
+	actFirst:         func(w *window) { w.goTo(0) },
+	actLast:          func(w *window) { w.goTo(w.store.len() - 1) },
+	actZoomIn:        func(w *window) { w.unfit(); w.setZoom(w.zoom * zoomStep) },
+	actZoomOut:       func(w *window) { w.unfit(); w.setZoom(w.zoom / zoomStep) },
+	actFit:           (*window).toggleFit,
+	actActualSize:    (*window).actualSize,
+	actResetView:     (*window).resetView,
+	actRotateCW:      func(w *window) { w.rotate(true) },
+	actRotateCCW:     func(w *window) { w.rotate(false) },
+	actRotateAngle:   func(w *window) { w.angle, w.number = true, "" },
+	actFlipH:         func(w *window) { w.flip(true) },
+	actFlipV:         func(w *window) { w.flip(false) },
+	actFilter:        (*window).cycleFilter,
+	actPanLeft:       func(w *window) { w.panBy(image.Point{w.panStep(), 0}) },
+	actPanRight:      func(w *window) { w.panBy(image.Point{-w.panStep(), 0}) },
+	actPanUp:         func(w *window) { w.panBy(image.Point{0, w.panStep()}) },
+	actPanDown:       func(w *window) { w.panBy(image.Point{0, -w.panStep()}) },
+	actDelete:        (*window).delete,
+	actCopyPath:      (*window).copyPath,
+	actSave:          (*window).save,
+	actInfo:          func(w *window) { w.info = !w.info },
+	actMetadata:      (*window).printMetadata,
+	actInspect:       (*window).toggleInspect,
+	actHistogram:     (*window).toggleHistogram,
+	actGrid:          (*window).toggleGrid,
+	actFullscreen:    (*window).toggleFullscreen,
+	actResizeToImage: (*window).resizeToImage,
+	actMark:          func(w *window) { w.store.toggleMark(w.i) },
+	actMove:          (*window).move,
+	actInterp:        (*window).toggleInterp,
+	actOrientation:   (*window).toggleOrientation,
+	actCrop:          (*window).toggleCrop,
+	actInterpDiff:    (*window).toggleInterpDiff,
+}
+
+// repeatable is the set of actions which are repeated while their key is held
+// down.
+var repeatable = map[action]bool{
+	actZoomIn:   true,
+	actZoomOut:  true,
+	actPanLeft:  true,
+	actPanRight: true,
+	actPanUp:    true,
+	actPanDown:  true,
+}
+
+// navigation is the set of actions which show other images, disabled by
+// Options.Once.
+var navigation = map[action]bool{
+	actNext:      true,
+	actPrev:      true,
+	actFirst:     true,
+	actLast:      true,
+	actGrid:      true,
+	actNewWindow: true,
+}
+
+func init() {
+	// opening a window starts its event loop, which looks up the actions:
+	// this one can't be part of the initializer of actions.
+	actions[actNewWindow] = func(w *window) { w.viewer.clone(w) }
+}
+
+// keystroke is a key pressed along with modifiers.
+type keystroke struct {
+	code key.Code
+	mods key.Modifiers
+}
+
+// bindings maps keystrokes to the actions they trigger by default. They may
+// be overridden by the user's key configuration file.
+var bindings = map[keystroke]action{
+	{key.CodeEscape, 0}:                actQuit,
+	{key.CodeQ, 0}:                     actQuit,
+	{key.CodeRightArrow, 0}:            actNext,
+	{key.CodeLeftArrow, 0}:             actPrev,
+	{key.CodeLeftArrow, key.ModShift}:  actPanLeft,
+	{key.CodeRightArrow, key.ModShift}: actPanRight,
+	{key.CodeUpArrow, key.ModShift}:    actPanUp,
+	{key.CodeDownArrow, key.ModShift}:  actPanDown,
+	{key.CodeG, 0}:                     actFirst,
+	{key.CodeG, key.ModShift}:          actLast,
+	{key.CodeEqualSign, 0}:             actZoomIn,
+	{key.CodeKeypadPlusSign, 0}:        actZoomIn,
+	{key.CodeHyphenMinus, 0}:           actZoomOut,
+	{key.CodeKeypadHyphenMinus, 0}:     actZoomOut,
+	{key.CodeF, 0}:                     actFit,
+	{key.Code0, 0}:                     actActualSize,
+	{key.CodeHome, 0}:                  actResetView,
+	{key.CodeRightSquareBracket, 0}:    actRotateCW,
+	{key.CodeLeftSquareBracket, 0}:     actRotateCCW,
+	{key.CodeM, 0}:                     actFlipH,
+	{key.CodeM, key.ModShift}:          actFlipV,
+	{key.CodeH, 0}:                     actPanLeft,
+	{key.CodeL, 0}:                     actPanRight,
+	{key.CodeK, 0}:                     actPanUp,
+	{key.CodeJ, 0}:                     actPanDown,
+	{key.CodeD, 0}:                     actDelete,
+	{key.CodeY, 0}:                     actCopyPath,
+	{key.CodeS, 0}:                     actSave,
+	{key.CodeI, 0}:                     actInfo,
+	{key.CodeT, 0}:                     actGrid,
+	{key.CodeF11, 0}:                   actFullscreen,
+	{key.CodeR, 0}:                     actResizeToImage,
+	{key.CodeB, 0}:                     actMark,
+	{key.CodeA, 0}:                     actRotateAngle,
+	{key.CodeC, 0}:                     actFilter,
+	{key.CodeP, 0}:                     actInspect,
+	{key.CodeH, key.ModShift}:          actHistogram,
+	{key.CodeI, key.ModShift}:          actMetadata,
+	{key.CodeN, 0}:                     actNewWindow,
+	{key.CodeV, 0}:                     actMove,
+	{key.CodeZ, 0}:                     actInterp,
+	{key.CodeE, 0}:                     actOrientation,
+	{key.CodeX, 0}:                     actCrop,
+	{key.CodeZ, key.ModShift}:          actInterpDiff,
+
+	// Control pans by a single pixel, see panStep.
+	{key.CodeLeftArrow, key.ModControl}:  actPanLeft,
+	{key.CodeRightArrow, key.ModControl}: actPanRight,
+	{key.CodeUpArrow, key.ModControl}:    actPanUp,
+	{key.CodeDownArrow, key.ModControl}:  actPanDown,
+}
+
+// defaultBindings returns a copy of the default key bindings.
+func defaultBindings() map[keystroke]action {
+	keys := make(map[keystroke]action, len(bindings))
+	for ks, act := range bindings {
+		keys[ks] = act
+	}
+	return keys
+}
+
+// lookupKey returns the action bound to the key event e.
+// Keystrokes with modifiers fall back to the action bound to the bare key,
+// so that e.g. shift+'=' (i.e. '+') zooms in. The navigation actions are
+// ignored when Options.Once is set.
+func (w *window) lookupKey(e key.Event) action {
+	mods := e.Modifiers & (key.ModShift | key.ModControl | key.ModAlt | key.ModMeta)
+	act, ok := w.keys[keystroke{e.Code, mods}]
+	if !ok {
+		act, ok = w.keys[keystroke{e.Code, 0}]
+	}
+	if !ok || w.opts.Once && navigation[act] {
+		return actNone
+	}
+	return act
+}
+
+// keyNames maps the names usable in the key configuration file to key
+// codes. Letters and digits are named after themselves.
+var keyNames = map[string]key.Code{
+	"escape":    key.CodeEscape,
+	"enter":     key.CodeReturnEnter,
+	"tab":       key.CodeTab,
+	"space":     key.CodeSpacebar,
+	"backspace": key.CodeDeleteBackspace,
+	"delete":    key.CodeDeleteForward,
+	"insert":    key.CodeInsert,
+	"home":      key.CodeHome,
+	"end":       key.CodeEnd,
+	"pageup":    key.CodePageUp,
+	"pagedown":  key.CodePageDown,
+	"left":      key.CodeLeftArrow,
+	"right":     key.CodeRightArrow,
+	"up":        key.CodeUpArrow,
+	"down":      key.CodeDownArrow,
+	"-":         key.CodeHyphenMinus,
+	"=":         key.CodeEqualSign,
+	"[":         key.CodeLeftSquareBracket,
+	"]":         key.CodeRightSquareBracket,
+	"\\":        key.CodeBackslash,
+	";":         key.CodeSemicolon,
+	"'":         key.CodeApostrophe,
+	"`":         key.CodeGraveAccent,
+	",":         key.CodeComma,
+	".":         key.CodeFullStop,
+	"/":         key.CodeSlash,
+	"kp+":       key.CodeKeypadPlusSign,
+	"kp-":       key.CodeKeypadHyphenMinus,
+	"kp*":       key.CodeKeypadAsterisk,
+	"kp/":       key.CodeKeypadSlash,
+	"kpenter":   key.CodeKeypadEnter,
+}
+
+func init() {
+	for c := 'a'; c <= 'z'; c++ {
+		keyNames[string(c)] = key.CodeA + key.Code(c-'a')
+	}
+	keyNames["0"] = key.Code0
+	for c := '1'; c <= '9'; c++ {
+		keyNames[string(c)] = key.Code1 + key.Code(c-'1')
+	}
+	for i := 1; i <= 12; i++ {
+		keyNames[fmt.Sprintf("f%d", i)] = key.CodeF1 + key.Code(i-1)
+	}
+}
+
+// modNames maps the names of the modifiers to their value.
+var modNames = map[string]key.Modifiers{
+	"shift": key.ModShift,
+	"ctrl":  key.ModControl,
+	"alt":   key.ModAlt,
+	"meta":  key.ModMeta,
+}
+
+// parseKeystroke parses a keystroke such as "ctrl+shift+left".
+// A single upper case letter stands for the letter with shift, and "+" for
+// shift+'=', where it is on US keyboards.
+func parseKeystroke(s string) (keystroke, error) {
+	var ks keystroke
+	parts := strings.Split(s, "+")
+	name := parts[len(parts)-1]
+	if name == "" && len(parts) > 1 {
+		// the name ends with '+', e.g. "ctrl++" or "alt+kp+".
+		name, parts = parts[len(parts)-2]+"+", parts[:len(parts)-2]
+	} else {
+		parts = parts[:len(parts)-1]
+	}
+	if name == "+" {
+		name = "="
+		ks.mods |= key.ModShift
+	}
+	for _, p := range parts {
+		m, ok := modNames[strings.ToLower(p)]
+		if !ok {
+			return ks, fmt.Errorf("unknown modifier %q in key %q", p, s)
+		}
+		ks.mods |= m
+	}
+	if len(name) == 1 && 'A' <= name[0] && name[0] <= 'Z' {
+		ks.mods |= key.ModShift
+	}
+	code, ok := keyNames[strings.ToLower(name)]
+	if !ok {
+		return ks, fmt.Errorf("unknown key %q", s)
+	}
+	ks.code = code
+	return ks, nil
+}
+
+// KeyConfigPath returns the default path of the key configuration file,
+// under the user's configuration directory.
+func KeyConfigPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "iview", "keys.toml"), nil
+}
+
+// loadKeyConfig overrides the key bindings in keys with the ones of the
+// key configuration file at path, if it exists. The file holds a [keys] table
+// mapping keystrokes to action names, e.g.:
+//
+//	[keys]
+//	"space" = "next"
+//	"shift+space" = "prev"
+//	"d" = "none"
+func loadKeyConfig(path string, keys map[keystroke]action) error {
+	var cfg struct {
+		Keys map[string]string `toml:"keys"`
+	}
+	if _, err := toml.DecodeFile(path, &cfg); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	for k, a := range cfg.Keys {
+		ks, err := parseKeystroke(k)
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		act := action(a)
+		if _, ok := actions[act]; !ok && act != actNone {
+			return fmt.Errorf("%s: unknown action %q for key %q", path, a, k)
+		}
+		keys[ks] = act
+	}
+	log.Printf("Loaded key bindings from '%s'.", path)
+	return nil
+}
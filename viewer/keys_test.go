@@ -0,0 +1,46 @@
+package viewer
+
+import (
+	"testing"
+
+	"golang.org/x/mobile/event/key"
+)
+
+func TestParseKeystroke(t *testing.T) {
+	for _, tc := range []struct {
+		s    string
+		want keystroke
+		err  bool
+	}{
+		{s: "q", want: keystroke{key.CodeQ, 0}},
+		{s: "Q", want: keystroke{key.CodeQ, key.ModShift}},
+		{s: "shift+q", want: keystroke{key.CodeQ, key.ModShift}},
+		{s: "ctrl+shift+left", want: keystroke{key.CodeLeftArrow, key.ModControl | key.ModShift}},
+		{s: "Ctrl+Right", want: keystroke{key.CodeRightArrow, key.ModControl}},
+		{s: "space", want: keystroke{key.CodeSpacebar, 0}},
+		{s: "f11", want: keystroke{key.CodeF11, 0}},
+		{s: "0", want: keystroke{key.Code0, 0}},
+		{s: "9", want: keystroke{key.Code9, 0}},
+		{s: "=", want: keystroke{key.CodeEqualSign, 0}},
+		{s: "+", want: keystroke{key.CodeEqualSign, key.ModShift}},
+		{s: "shift++", want: keystroke{key.CodeEqualSign, key.ModShift}},
+		{s: "ctrl++", want: keystroke{key.CodeEqualSign, key.ModControl | key.ModShift}},
+		{s: "kp+", want: keystroke{key.CodeKeypadPlusSign, 0}},
+		{s: "alt+kp+", want: keystroke{key.CodeKeypadPlusSign, key.ModAlt}},
+		{s: "hyper+q", err: true},
+		{s: "nosuchkey", err: true},
+		{s: "", err: true},
+	} {
+		t.Run(tc.s, func(t *testing.T) {
+			got, err := parseKeystroke(tc.s)
+			switch {
+			case tc.err && err == nil:
+				t.Errorf("parseKeystroke(%q) = %v, want an error", tc.s, got)
+			case !tc.err && err != nil:
+				t.Errorf("parseKeystroke(%q): %v", tc.s, err)
+			case !tc.err && got != tc.want:
+				t.Errorf("parseKeystroke(%q) = %v, want %v", tc.s, got, tc.want)
+			}
+		})
+	}
+}
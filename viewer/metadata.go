@@ -0,0 +1,74 @@
+package viewer
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+)
+
+// printMetadata writes the metadata of the current image to stdout.
+func (w *window) printMetadata() {
+	img, err := w.store.get(w.i)
+	if err != nil {
+		return
+	}
+	path := w.store.path(w.i)
+	if !IsURL(path) {
+		if abs, err := filepath.Abs(path); err == nil {
+			path = abs
+		}
+	}
+	b := img.Bounds()
+	info := w.store.info(w.i)
+
+	fmt.Printf("path: %s\n", path)
+	fmt.Printf("format: %s\n", info.format)
+	fmt.Printf("dimensions: %dx%d\n", b.Dx(), b.Dy())
+	fmt.Printf("color model: %s\n", colorModelName(img))
+	if fi, err := os.Stat(path); err == nil {
+		fmt.Printf("file size: %s (%d bytes)\n", byteSize(fi.Size()), fi.Size())
+	}
+	fmt.Printf("decode time: %s\n", info.decodeTime)
+	if info.format == "jpeg" {
+		if f, err := openFile(path); err == nil {
+			for _, field := range exifFields(f) {
+				fmt.Printf("%s: %s\n", field.name, field.value)
+			}
+			f.Close()
+		}
+	}
+	fmt.Println()
+}
+
+// colorModelName returns the name of the color model of img.
+func colorModelName(img image.Image) string {
+	switch img.(type) {
+	case *image.Paletted:
+		return "paletted"
+	case *image.YCbCr:
+		return "YCbCr"
+	case *image.CMYK:
+		return "CMYK"
+	}
+	switch img.ColorModel() {
+	case color.RGBAModel:
+		return "RGBA"
+	case color.RGBA64Model:
+		return "RGBA64"
+	case color.NRGBAModel:
+		return "NRGBA"
+	case color.NRGBA64Model:
+		return "NRGBA64"
+	case color.AlphaModel:
+		return "alpha"
+	case color.Alpha16Model:
+		return "alpha16"
+	case color.GrayModel:
+		return "gray"
+	case color.Gray16Model:
+		return "gray16"
+	}
+	return fmt.Sprintf("%T", img.ColorModel())
+}
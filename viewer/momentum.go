@@ -0,0 +1,161 @@
+package viewer
+
+import (
+	"image"
+	"math"
+	"time"
+
+	"golang.org/x/mobile/event/paint"
+)
+
+const (
+	// glideWindow is how far back the mouse positions are considered to
+	// estimate the velocity of a drag.
+	glideWindow = 100 * time.Millisecond
+
+	// glideFrame is the interval between two frames of a glide.
+	glideFrame = time.Second / 60
+
+	// glideFriction is the fraction of its velocity a glide retains after
+	// one second.
+	glideFriction = 0.02
+
+	// glideMinSpeed is the speed, in pixels per second, below which a
+	// glide stops.
+	glideMinSpeed = 20
+)
+
+// dragSample is a mouse position recorded while dragging the image.
+type dragSample struct {
+	pos image.Point
+	t   time.Time
+}
+
+// glide is the animation of the image sliding after it was flicked with the
+// mouse, until friction stops it.
+type glide struct {
+	vx, vy float64 // velocity, in pixels per second
+	fx, fy float64 // fractional part of the displacement not applied yet
+	last   time.Time
+	stop   chan struct{} // nil while the glide is paused
+}
+
+// glideEvent is sent to the window for each frame of the glide g.
+type glideEvent struct {
+	g *glide
+}
+
+// track records the mouse position pos while dragging the image.
+func (w *window) track(pos image.Point) {
+	now := time.Now()
+	n := 0
+	for _, s := range w.drag {
+		if now.Sub(s.t) <= glideWindow {
+			w.drag[n] = s
+			n++
+		}
+	}
+	w.drag = append(w.drag[:n], dragSample{pos, now})
+}
+
+// startGlide starts sliding the image with the velocity of the mouse at the
+// end of the drag, unless the mouse was at rest when it was released.
+func (w *window) startGlide() {
+	samples := w.drag
+	w.drag = w.drag[:0]
+	if w.opts.NoMomentum || w.fit || len(samples) < 2 {
+		return
+	}
+	first, last := samples[0], samples[len(samples)-1]
+	dt := last.t.Sub(first.t).Seconds()
+	if dt <= 0 || time.Since(last.t) > glideWindow/2 {
+		return
+	}
+	d := last.pos.Sub(first.pos)
+	g := &glide{
+		vx:   float64(d.X) / dt,
+		vy:   float64(d.Y) / dt,
+		last: time.Now(),
+	}
+	if math.Hypot(g.vx, g.vy) < glideMinSpeed {
+		return
+	}
+
+	w.stopGlide()
+	w.glide = g
+	if !w.unfocused {
+		w.animate(g)
+	}
+}
+
+// animate sends the frames of the glide g to the window, until g.stop is
+// closed.
+func (w *window) animate(g *glide) {
+	g.stop = make(chan struct{})
+	go func() {
+		tick := time.NewTicker(glideFrame)
+		defer tick.Stop()
+		for {
+			select {
+			case <-g.stop:
+				return
+			case <-tick.C:
+				w.w.Send(glideEvent{g})
+			}
+		}
+	}()
+}
+
+// stopGlide stops the current glide, if any.
+func (w *window) stopGlide() {
+	if w.glide == nil {
+		return
+	}
+	w.pauseGlide()
+	w.glide = nil
+}
+
+// pauseGlide stops sending the frames of the current glide, if any, until
+// resumeGlide is called.
+func (w *window) pauseGlide() {
+	if w.glide == nil || w.glide.stop == nil {
+		return
+	}
+	close(w.glide.stop)
+	w.glide.stop = nil
+}
+
+// resumeGlide resumes the current glide, if any, where it was paused.
+func (w *window) resumeGlide() {
+	if w.glide == nil || w.glide.stop != nil {
+		return
+	}
+	w.glide.last = time.Now()
+	w.animate(w.glide)
+}
+
+// stepGlide moves the image by one frame of the glide g.
+func (w *window) stepGlide(g *glide) {
+	if g != w.glide {
+		// a frame of a glide which was stopped in the meantime.
+		return
+	}
+
+	now := time.Now()
+	dt := now.Sub(g.last).Seconds()
+	g.last = now
+	f := math.Pow(glideFriction, dt)
+	g.vx, g.vy = g.vx*f, g.vy*f
+	if w.fit || math.Hypot(g.vx, g.vy) < glideMinSpeed {
+		w.stopGlide()
+		return
+	}
+
+	g.fx, g.fy = g.fx+g.vx*dt, g.fy+g.vy*dt
+	d := image.Point{int(g.fx), int(g.fy)}
+	g.fx, g.fy = g.fx-float64(d.X), g.fy-float64(d.Y)
+	if d != (image.Point{}) {
+		w.panBy(d)
+		w.w.Send(paint.Event{})
+	}
+}
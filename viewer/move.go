@@ -0,0 +1,78 @@
+package viewer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// moveFile moves the file src into the directory dir, and returns its new
+// path. A counter is appended to the name of the file if dir already holds
+// a file with the same name, e.g. "image-1.png".
+func moveFile(src, dir string) (string, error) {
+	dst, err := freePath(dir, filepath.Base(src))
+	if err != nil {
+		return "", err
+	}
+	if err := os.Rename(src, dst); err == nil {
+		return dst, nil
+	}
+
+	// src and dir may be on different file systems: copy the file instead.
+	if err := copyFile(dst, src); err != nil {
+		os.Remove(dst)
+		return "", err
+	}
+	if err := os.Remove(src); err != nil {
+		os.Remove(dst)
+		return "", err
+	}
+	return dst, nil
+}
+
+// freePath returns the path of a file named name in dir that doesn't exist
+// yet.
+func freePath(dir, name string) (string, error) {
+	ext := filepath.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	for n := 0; ; n++ {
+		path := filepath.Join(dir, name)
+		if n > 0 {
+			path = filepath.Join(dir, fmt.Sprintf("%s-%d%s", stem, n, ext))
+		}
+		_, err := os.Lstat(path)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			return path, nil
+		case err != nil:
+			return "", err
+		}
+	}
+}
+
+// copyFile copies the content and the permissions of the file src to the
+// new file dst.
+func copyFile(dst, src string) error {
+	r, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	fi, err := r.Stat()
+	if err != nil {
+		return err
+	}
+	w, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
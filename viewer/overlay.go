@@ -0,0 +1,130 @@
+package viewer
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"sync"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// The colors of the overlays drawn over the images, and of the dots of the
+// loading spinner. They are set by the theme, see useTheme.
+var (
+	overlayBg  color.Color = color.RGBA{0x00, 0x00, 0x00, 0xb0}
+	overlayFg  color.Color = color.White
+	spinnerDim color.Color = color.RGBA{0x60, 0x60, 0x60, 0xff}
+	spinnerLit color.Color = color.White
+)
+
+// overlayFace is the font face used to write the text of the overlays.
+var overlayFace font.Face = basicfont.Face7x13
+
+// overlayPad is the padding, in pixels, around the text of the overlays.
+const overlayPad = 4
+
+// textHeight returns the height of a box holding a line of overlay text.
+func textHeight() int {
+	return overlayFace.Metrics().Height.Ceil() + 2*overlayPad
+}
+
+// drawTextBox draws the text s over a translucent box covering r.
+func drawTextBox(dst draw.Image, r image.Rectangle, s string) {
+	draw.Draw(dst, r, image.NewUniform(overlayBg), image.Point{}, draw.Over)
+	ascent := overlayFace.Metrics().Ascent.Ceil()
+	d := font.Drawer{
+		Dst:  dst,
+		Src:  image.NewUniform(overlayFg),
+		Face: overlayFace,
+		Dot:  fixed.P(r.Min.X+overlayPad, r.Min.Y+overlayPad+ascent),
+	}
+	d.DrawString(s)
+}
+
+// spinnerDots is the number of dots of the loading spinner, one of which is
+// highlighted in turn at each frame.
+const spinnerDots = 8
+
+// drawSpinner draws the frame-th frame of the loading spinner, captioned
+// "Loading...", at the center of dst.
+func drawSpinner(dst draw.Image, frame int) {
+	const radius, dot = 16, 3
+	c := dst.Bounds().Min.Add(image.Point{dst.Bounds().Dx() / 2, dst.Bounds().Dy() / 2})
+	for i := 0; i < spinnerDots; i++ {
+		a := 2 * math.Pi * float64(i) / spinnerDots
+		p := c.Add(image.Point{
+			int(radius * math.Cos(a)),
+			int(radius * math.Sin(a)),
+		})
+		col := spinnerDim
+		if i == frame%spinnerDots {
+			col = spinnerLit
+		}
+		r := image.Rect(p.X-dot, p.Y-dot, p.X+dot, p.Y+dot)
+		draw.Draw(dst, r, image.NewUniform(col), image.Point{}, draw.Src)
+	}
+
+	const caption = "Loading..."
+	w := font.MeasureString(overlayFace, caption).Ceil() + 2*overlayPad
+	tl := c.Add(image.Point{-w / 2, radius + 2*dot})
+	drawTextBox(dst, image.Rectangle{tl, tl.Add(image.Point{w, textHeight()})}, caption)
+}
+
+// broken is the placeholder displayed instead of the images that failed to
+// decode. It is generated on first use.
+var (
+	broken     *image.RGBA
+	brokenOnce sync.Once
+)
+
+// brokenImage returns a placeholder for images that can't be decoded: a
+// crossed out frame with a caption.
+func brokenImage() image.Image {
+	brokenOnce.Do(makeBroken)
+	return broken
+}
+
+func makeBroken() {
+	const w, h = 200, 150
+	broken = image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(broken, broken.Bounds(), image.NewUniform(color.RGBA{0x40, 0x40, 0x40, 0xff}),
+		image.Point{}, draw.Src)
+	red := color.RGBA{0xc0, 0x20, 0x20, 0xff}
+	for x := 0; x < w; x++ {
+		y := x * (h - 1) / (w - 1)
+		broken.SetRGBA(x, y, red)
+		broken.SetRGBA(x, h-1-y, red)
+	}
+	for x := 0; x < w; x++ {
+		broken.SetRGBA(x, 0, red)
+		broken.SetRGBA(x, h-1, red)
+	}
+	for y := 0; y < h; y++ {
+		broken.SetRGBA(0, y, red)
+		broken.SetRGBA(w-1, y, red)
+	}
+
+	const caption = "failed to decode"
+	cw := font.MeasureString(overlayFace, caption).Ceil() + 2*overlayPad
+	r := image.Rect(0, 0, cw, textHeight()).Add(image.Point{(w - cw) / 2, (h - textHeight()) / 2})
+	drawTextBox(broken, r, caption)
+}
+
+// byteSize formats a number of bytes in a human readable way.
+func byteSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
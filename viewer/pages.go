@@ -0,0 +1,172 @@
+package viewer
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// PagePath returns the path of the given page, counted from 0, of the
+// multi-page TIFF file at path, as expected in Options.Files, e.g.
+// "scan.tif[1]".
+func PagePath(path string, page int) string {
+	return fmt.Sprintf("%s[%d]", path, page)
+}
+
+// splitPage splits the path of a page of a multi-page TIFF file into the
+// path of the file and the index of the page. ok is false for the paths of
+// whole files.
+func splitPage(path string) (file string, page int, ok bool) {
+	i := strings.LastIndex(path, "[")
+	if i < 0 || !strings.HasSuffix(path, "]") || !isTIFF(path[:i]) {
+		return "", 0, false
+	}
+	page, err := strconv.Atoi(path[i+1 : len(path)-1])
+	if err != nil || page < 0 {
+		return "", 0, false
+	}
+	return path[:i], page, true
+}
+
+// isPage reports whether path refers to a page of a multi-page TIFF file.
+func isPage(path string) bool {
+	_, _, ok := splitPage(path)
+	return ok
+}
+
+// isTIFF reports whether the named file has the extension of a TIFF file.
+func isTIFF(fName string) bool {
+	name := strings.ToLower(fName)
+	return strings.HasSuffix(name, ".tif") || strings.HasSuffix(name, ".tiff")
+}
+
+// maxPages bounds the number of pages read from a TIFF file, should its
+// directories loop.
+const maxPages = 10000
+
+// tiffDirs returns the byte order of the TIFF file read from r, and the
+// offsets of its image file directories, one per page.
+func tiffDirs(r io.ReaderAt) (binary.ByteOrder, []uint32, error) {
+	var hdr [8]byte
+	if _, err := r.ReadAt(hdr[:], 0); err != nil {
+		return nil, nil, err
+	}
+	var order binary.ByteOrder
+	switch string(hdr[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, nil, errors.New("not a TIFF file")
+	}
+	if order.Uint16(hdr[2:4]) != 42 {
+		return nil, nil, errors.New("not a TIFF file")
+	}
+
+	var (
+		dirs []uint32
+		seen = make(map[uint32]bool)
+		buf  [4]byte
+	)
+	for off := order.Uint32(hdr[4:8]); off != 0 && !seen[off] && len(dirs) < maxPages; {
+		seen[off] = true
+		dirs = append(dirs, off)
+		if _, err := r.ReadAt(buf[:2], int64(off)); err != nil {
+			return nil, nil, err
+		}
+		n := int64(order.Uint16(buf[:2]))
+		if _, err := r.ReadAt(buf[:], int64(off)+2+12*n); err != nil {
+			return nil, nil, err
+		}
+		off = order.Uint32(buf[:])
+	}
+	return order, dirs, nil
+}
+
+// TIFFPages returns the number of pages of the TIFF file at path.
+func TIFFPages(path string) (int, error) {
+	f, err := openFile(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	_, dirs, err := tiffDirs(readerAt{f})
+	return len(dirs), err
+}
+
+// openPage opens the given page of the TIFF file at path, as a TIFF file
+// whose first page is that one: the TIFF decoders only read the first page
+// of the files.
+func openPage(path string, page int) (io.ReadSeekCloser, error) {
+	f, err := openFile(path)
+	if err != nil {
+		return nil, err
+	}
+	order, dirs, err := tiffDirs(readerAt{f})
+	if err == nil && page >= len(dirs) {
+		err = fmt.Errorf("'%s' has no page %d", path, page)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	p := &pageFile{f: readerAt{f}}
+	if _, err := p.f.ReadAt(p.hdr[:], 0); err != nil {
+		f.Close()
+		return nil, err
+	}
+	order.PutUint32(p.hdr[4:8], dirs[page])
+	return struct {
+		*io.SectionReader
+		io.Closer
+	}{io.NewSectionReader(p, 0, size), f}, nil
+}
+
+// pageFile reads a TIFF file through a header of its own, pointing at the
+// directory of another page than the first one.
+type pageFile struct {
+	f   io.ReaderAt
+	hdr [8]byte
+}
+
+func (p *pageFile) ReadAt(b []byte, off int64) (int, error) {
+	n := 0
+	if off < int64(len(p.hdr)) {
+		n = copy(b, p.hdr[off:])
+		if n == len(b) {
+			return n, nil
+		}
+	}
+	m, err := p.f.ReadAt(b[n:], off+int64(n))
+	return n + m, err
+}
+
+// readerAt implements io.ReaderAt on top of an io.ReadSeeker. Reads
+// aren't safe for concurrent use.
+type readerAt struct {
+	io.ReadSeeker
+}
+
+func (r readerAt) ReadAt(b []byte, off int64) (int, error) {
+	if ra, ok := r.ReadSeeker.(io.ReaderAt); ok {
+		return ra.ReadAt(b, off)
+	}
+	if _, err := r.Seek(off, io.SeekStart); err != nil {
+		return 0, err
+	}
+	n, err := io.ReadFull(r, b)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return n, err
+}
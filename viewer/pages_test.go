@@ -0,0 +1,169 @@
+package viewer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSplitPage(t *testing.T) {
+	for _, tc := range []struct {
+		path string
+		file string
+		page int
+		ok   bool
+	}{
+		{"scan.tif[1]", "scan.tif", 1, true},
+		{"scan.tif[0]", "scan.tif", 0, true},
+		{"dir/Scan.TIFF[12]", "dir/Scan.TIFF", 12, true},
+		{"a[1].tif[2]", "a[1].tif", 2, true},
+		{"scan.tif", "", 0, false},
+		{"scan.png[1]", "", 0, false},
+		{"scan.tif[-1]", "", 0, false},
+		{"scan.tif[x]", "", 0, false},
+		{"scan.tif[]", "", 0, false},
+		{"scan.tif[1", "", 0, false},
+	} {
+		t.Run(tc.path, func(t *testing.T) {
+			file, page, ok := splitPage(tc.path)
+			if file != tc.file || page != tc.page || ok != tc.ok {
+				t.Errorf("splitPage(%q) = %q, %d, %v, want %q, %d, %v",
+					tc.path, file, page, ok, tc.file, tc.page, tc.ok)
+			}
+		})
+	}
+}
+
+// tiffBytes returns a TIFF file whose directories, with no entries, follow
+// the header one after the other. The i-th directory links to the next[i]-th
+// one, or to none if that is negative.
+func tiffBytes(order binary.ByteOrder, next []int) []byte {
+	var buf bytes.Buffer
+	if order == binary.LittleEndian {
+		buf.WriteString("II")
+	} else {
+		buf.WriteString("MM")
+	}
+	binary.Write(&buf, order, uint16(42))
+	first := uint32(0)
+	if len(next) > 0 {
+		first = tiffDirOffset(0)
+	}
+	binary.Write(&buf, order, first)
+	for _, n := range next {
+		off := uint32(0)
+		if n >= 0 {
+			off = tiffDirOffset(n)
+		}
+		binary.Write(&buf, order, uint16(0))
+		binary.Write(&buf, order, off)
+	}
+	return buf.Bytes()
+}
+
+// tiffDirOffset returns the offset of the i-th directory of tiffBytes.
+func tiffDirOffset(i int) uint32 {
+	return uint32(8 + 6*i)
+}
+
+func TestTIFFDirs(t *testing.T) {
+	// chain returns the links of n directories following each other.
+	chain := func(n int) []int {
+		next := make([]int, n)
+		for i := range next {
+			next[i] = i + 1
+		}
+		next[n-1] = -1
+		return next
+	}
+	for _, tc := range []struct {
+		name  string
+		data  []byte
+		order binary.ByteOrder
+		pages int
+		err   bool
+	}{
+		{"single page", tiffBytes(binary.LittleEndian, chain(1)), binary.LittleEndian, 1, false},
+		{"little endian", tiffBytes(binary.LittleEndian, chain(3)), binary.LittleEndian, 3, false},
+		{"big endian", tiffBytes(binary.BigEndian, chain(3)), binary.BigEndian, 3, false},
+		{"no directory", tiffBytes(binary.LittleEndian, nil), binary.LittleEndian, 0, false},
+		{"loop", tiffBytes(binary.LittleEndian, []int{1, 2, 0}), binary.LittleEndian, 3, false},
+		{"self loop", tiffBytes(binary.BigEndian, []int{1, 1}), binary.BigEndian, 2, false},
+		{"max pages", tiffBytes(binary.LittleEndian, chain(maxPages+5)), binary.LittleEndian, maxPages, false},
+		{"not a TIFF file", []byte("\x89PNG\r\n\x1a\n"), nil, 0, true},
+		{"bad magic", []byte("II\x2b\x00\x08\x00\x00\x00"), nil, 0, true},
+		{"truncated", tiffBytes(binary.LittleEndian, chain(2))[:12], nil, 0, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			order, dirs, err := tiffDirs(bytes.NewReader(tc.data))
+			switch {
+			case tc.err && err == nil:
+				t.Fatalf("tiffDirs succeeded, with %d pages", len(dirs))
+			case tc.err:
+				return
+			case err != nil:
+				t.Fatal(err)
+			}
+			if order != tc.order {
+				t.Errorf("byte order = %v, want %v", order, tc.order)
+			}
+			if len(dirs) != tc.pages {
+				t.Fatalf("%d pages, want %d", len(dirs), tc.pages)
+			}
+			for i, off := range dirs {
+				if off != tiffDirOffset(i) {
+					t.Errorf("page %d at %d, want %d", i, off, tiffDirOffset(i))
+				}
+			}
+		})
+	}
+}
+
+func TestOpenPage(t *testing.T) {
+	data := tiffBytes(binary.BigEndian, []int{1, 2, -1})
+	path := filepath.Join(t.TempDir(), "scan.tif")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		page int
+		err  bool
+	}{
+		{0, false},
+		{2, false},
+		{3, true},
+	} {
+		t.Run(fmt.Sprint(tc.page), func(t *testing.T) {
+			f, err := openFile(PagePath(path, tc.page))
+			switch {
+			case tc.err && err == nil:
+				f.Close()
+				t.Fatal("openFile succeeded")
+			case tc.err:
+				return
+			case err != nil:
+				t.Fatal(err)
+			}
+			defer f.Close()
+			got, err := io.ReadAll(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// only the offset of the first directory differs.
+			want := bytes.Clone(data)
+			binary.BigEndian.PutUint32(want[4:8], tiffDirOffset(tc.page))
+			if !bytes.Equal(got, want) {
+				t.Errorf("page %d reads as\n%x\nwant\n%x", tc.page, got, want)
+			}
+			_, dirs, err := tiffDirs(readerAt{f})
+			if err != nil || len(dirs) != 3-tc.page {
+				t.Errorf("page %d has %d directories (%v), want %d",
+					tc.page, len(dirs), err, 3-tc.page)
+			}
+		})
+	}
+}
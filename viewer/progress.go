@@ -0,0 +1,75 @@
+package viewer
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// progressDelay is how long a batch runs before its progress is
+	// reported, so that quick batches don't report anything.
+	progressDelay = 500 * time.Millisecond
+
+	// progressPeriod is the minimal interval between two reports.
+	progressPeriod = 250 * time.Millisecond
+)
+
+// progress reports the progress of a batch of images being decoded in the
+// background. It is logged when verbose, and written as a single updating
+// line to stderr otherwise.
+type progress struct {
+	label   string
+	verbose bool
+
+	mu          sync.Mutex
+	done, total int
+	start, last time.Time
+	shown       bool // whether the progress was reported yet
+}
+
+func newProgress(label string, verbose bool) *progress {
+	return &progress{label: label, verbose: verbose, start: time.Now()}
+}
+
+// setRemaining sets the number of images still to be decoded.
+func (p *progress) setRemaining(n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.total = p.done + n
+}
+
+// step records that one more image was decoded.
+func (p *progress) step() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done++
+
+	now := time.Now()
+	switch {
+	case now.Sub(p.start) < progressDelay:
+		return
+	case p.done < p.total && now.Sub(p.last) < progressPeriod:
+		return
+	}
+	p.last = now
+	p.shown = true
+
+	pct := 100 * p.done / max(1, p.total)
+	if p.verbose {
+		log.Printf("%s: decoded %d/%d (%d%%).", p.label, p.done, p.total, pct)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "\r%s: decoded %d/%d (%d%%)", p.label, p.done, p.total, pct)
+}
+
+// finish ends the report of the progress.
+func (p *progress) finish() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.shown && !p.verbose {
+		fmt.Fprintln(os.Stderr)
+	}
+}
@@ -0,0 +1,64 @@
+package viewer
+
+import (
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/tiff"
+)
+
+// defaultJPEGQuality is the quality used when encoding JPEG images, unless
+// told otherwise.
+const defaultJPEGQuality = 90
+
+// encodeImage encodes img into w, in the format matching the extension of
+// the file name fName. JPEG images are encoded with the given quality, from
+// 1 to 100.
+func encodeImage(w io.Writer, img image.Image, fName string, quality int) error {
+	switch ext := strings.ToLower(filepath.Ext(fName)); ext {
+	case ".png":
+		return png.Encode(w, img)
+	case ".jpg", ".jpeg":
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: quality})
+	case ".gif":
+		return gif.Encode(w, img, nil)
+	case ".bmp":
+		return bmp.Encode(w, img)
+	case ".tif", ".tiff":
+		return tiff.Encode(w, img, nil)
+	default:
+		return fmt.Errorf("can't encode images with extension %q", ext)
+	}
+}
+
+// saveImage writes img to the file fName, in the format matching its
+// extension. The image is first written to a temporary file which then
+// replaces fName, so that the original file is left untouched on error.
+// JPEG images are encoded with the given quality.
+func saveImage(fName string, img image.Image, quality int) error {
+	f, err := os.CreateTemp(filepath.Dir(fName), ".iview-*"+filepath.Ext(fName))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if err := encodeImage(f, img, fName, quality); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if fi, err := os.Stat(fName); err == nil {
+		os.Chmod(f.Name(), fi.Mode())
+	}
+	return os.Rename(f.Name(), fName)
+}
@@ -0,0 +1,579 @@
+package viewer
+
+import (
+	"image"
+	"log"
+	"sync"
+	"time"
+)
+
+// imageStore holds the list of image files to display and decodes them
+// lazily, the first time they are requested.
+// At most max decoded images are kept in memory: when that limit is
+// reached, the least recently used image is evicted and will be decoded
+// again if it is requested later on.
+// Images may also be decoded ahead of time by a background worker, see
+// prefetch.
+type imageStore struct {
+	mu      sync.Mutex
+	entries []*entry
+	max     int    // maximum number of decoded images kept in memory
+	cur     int    // index of the displayed image, which is never evicted
+	clock   uint64 // logical time, used to track the last use of images
+
+	gen  uint64           // generation of the latest prefetch request
+	reqs chan prefetchReq // pending prefetch request, if any
+	jobs chan prefetchJob // images of the request handed out to workers
+	quit chan struct{}    // closed to stop the prefetcher and the workers
+
+	archives []string // archives retained by the store, see retainArchives
+}
+
+// entry is an image file of the store, along with its decoded image.
+type entry struct {
+	path string // path of the file, see openFile
+	name string // base name of the file, for display
+
+	img image.Image // nil when the file isn't decoded
+	err error       // error that occurred while decoding the file
+
+	// The following are known once the file is decoded.
+	format     string        // image format, e.g. "png"
+	size       image.Point   // dimensions of the decoded image
+	decodeTime time.Duration // time it took to decode the file
+
+	used uint64 // logical time of the last use of img
+
+	marked bool // whether the user marked the image
+
+	// orientation is the EXIF orientation applied to img, so that it
+	// displays upright, or 0 until the file is decoded.
+	orientation int
+
+	// aspect is the ratio of the width to the height of the pixels of
+	// img, recorded in the file, or 0 if unknown.
+	aspect float64
+
+	// virtual is true when img isn't backed by a file, e.g. when it was
+	// read from stdin. It is then kept in memory.
+	virtual bool
+
+	// modified is true when img was replaced in memory (e.g. rotated).
+	// Such an image can't be decoded again, so it is never evicted.
+	modified bool
+
+	thumb image.Image // thumbnail of the image, once generated
+
+	// loading is non-nil while the file is being decoded, and is closed
+	// once decoding is done.
+	loading chan struct{}
+}
+
+func newEntry(path string) *entry {
+	return &entry{path: path, name: basename(path)}
+}
+
+// prefetchReq is a request to decode images in the background.
+type prefetchReq struct {
+	gen     uint64
+	entries []*entry
+
+	// thumbs is true when the thumbnails of the images are requested.
+	// done is then called after each thumbnail is generated.
+	thumbs bool
+	done   func()
+}
+
+// newImageStore returns a store of the images in files, keeping at most max
+// of them decoded in memory, and decoding up to jobs of them concurrently
+// in the background.
+func newImageStore(files []string, max, jobs int) *imageStore {
+	entries := make([]*entry, len(files))
+	for i, f := range files {
+		entries[i] = newEntry(f)
+	}
+	st := &imageStore{
+		entries: entries,
+		max:     max,
+		reqs:    make(chan prefetchReq, 1),
+		jobs:    make(chan prefetchJob),
+		quit:    make(chan struct{}),
+
+		archives: retainArchives(files),
+	}
+	go st.prefetcher()
+	for i := 0; i < jobs; i++ {
+		go st.worker()
+	}
+	return st
+}
+
+// close stops the background decoding of the images, and releases the
+// archives they are read from. The prefetch requests made afterwards are
+// ignored.
+func (st *imageStore) close() {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	select {
+	case <-st.quit:
+		// already closed.
+	default:
+		// the images being decoded are abandoned.
+		st.gen++
+		close(st.quit)
+		releaseArchives(st.archives)
+		st.archives = nil
+	}
+}
+
+// len returns the number of image files in the store.
+func (st *imageStore) len() int {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return len(st.entries)
+}
+
+// name returns the basename of the i-th image file.
+func (st *imageStore) name(i int) string {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.entries[i].name
+}
+
+// decodeErr returns the error that occurred while decoding the i-th image,
+// if any.
+func (st *imageStore) decodeErr(i int) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.entries[i].err
+}
+
+// imageInfo describes an image of the store.
+type imageInfo struct {
+	name       string
+	format     string        // "" until the file is decoded
+	size       image.Point   // dimensions of the image, as decoded
+	decodeTime time.Duration // time it took to decode the file
+}
+
+// info returns the description of the i-th image.
+func (st *imageStore) info(i int) imageInfo {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	it := st.entries[i]
+	return imageInfo{
+		name:       it.name,
+		format:     it.format,
+		size:       it.size,
+		decodeTime: it.decodeTime,
+	}
+}
+
+// path returns the path of the i-th image file.
+func (st *imageStore) path(i int) string {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.entries[i].path
+}
+
+// get returns the i-th image, decoding it if needed.
+func (st *imageStore) get(i int) (image.Image, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.decode(st.entries[i])
+}
+
+// at returns the i-th entry, which stays the same while images are added
+// to or removed from the store, unlike its index.
+func (st *imageStore) at(i int) *entry {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.entries[i]
+}
+
+// getEntry is like get, for an entry returned by at. It may have been
+// removed from the store since.
+func (st *imageStore) getEntry(it *entry) (image.Image, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.decode(it)
+}
+
+// decode returns the image of it, decoding the file if needed.
+// st.mu must be held by the caller. It is released while decoding.
+func (st *imageStore) decode(it *entry) (image.Image, error) {
+	for it.loading != nil {
+		// someone else is already decoding this file.
+		ch := it.loading
+		st.mu.Unlock()
+		<-ch
+		st.mu.Lock()
+	}
+
+	if it.err != nil {
+		return nil, it.err
+	}
+
+	if it.img == nil {
+		it.loading = make(chan struct{})
+		st.mu.Unlock()
+		start := time.Now()
+		d, err := decodeImage(it.path)
+		st.mu.Lock()
+		close(it.loading)
+		it.loading = nil
+		if err != nil {
+			// the error is kept, so that the file isn't decoded (and the
+			// error logged) over and over again.
+			log.Print(err)
+			it.err = err
+			return nil, err
+		}
+		it.img, it.format = d.img, d.format
+		it.orientation, it.aspect = d.orientation, d.aspect
+		it.size = d.img.Bounds().Size()
+		it.decodeTime = time.Since(start)
+		defer st.evict()
+	}
+
+	st.clock++
+	it.used = st.clock
+	return it.img, nil
+}
+
+// set replaces the i-th image, e.g. with a transformed version of it.
+func (st *imageStore) set(i int, img image.Image) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.clock++
+	it := st.entries[i]
+	if it.img == nil {
+		defer st.evict()
+	}
+	it.img = img
+	it.err = nil
+	it.used = st.clock
+	it.modified = true
+	it.orientation = 1
+}
+
+// modified reports whether the i-th image was replaced in memory, and not
+// saved yet.
+func (st *imageStore) modified(i int) bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.entries[i].modified
+}
+
+// toggleMark marks the i-th image, or unmarks it if it was marked.
+func (st *imageStore) toggleMark(i int) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.entries[i].marked = !st.entries[i].marked
+}
+
+// isMarked reports whether the i-th image is marked.
+func (st *imageStore) isMarked(i int) bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.entries[i].marked
+}
+
+// marked returns the paths of the marked image files, in order.
+func (st *imageStore) marked() []string {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	var files []string
+	for _, e := range st.entries {
+		if e.marked {
+			files = append(files, e.path)
+		}
+	}
+	return files
+}
+
+// files returns the paths of the image files of the store.
+func (st *imageStore) files() []string {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	files := make([]string, len(st.entries))
+	for i, it := range st.entries {
+		files[i] = it.path
+	}
+	return files
+}
+
+// setVirtual replaces the i-th image with img, which isn't backed by a
+// file.
+func (st *imageStore) setVirtual(i int, img image.Image) {
+	st.set(i, img)
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.entries[i].virtual = true
+}
+
+// isVirtual reports whether the i-th image isn't backed by a file.
+func (st *imageStore) isVirtual(i int) bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.entries[i].virtual
+}
+
+// orientation returns the EXIF orientation applied to the i-th image, 1 if
+// none.
+func (st *imageStore) orientation(i int) int {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return max(1, st.entries[i].orientation)
+}
+
+// aspect returns the ratio of the width to the height of the pixels of the
+// i-th image, as recorded in its file, or 0 if unknown.
+func (st *imageStore) aspect(i int) float64 {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.entries[i].aspect
+}
+
+// rename records that the i-th image file was moved to path.
+func (st *imageStore) rename(i int, path string) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	e := st.entries[i]
+	e.path, e.name = path, basename(path)
+}
+
+// saved records that the i-th image was written back to its file, so that
+// it can be evicted and decoded again.
+func (st *imageStore) saved(i int) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.entries[i].modified = false
+}
+
+// load returns the i-th image and marks it as the displayed one.
+// Files that can't be decoded are removed from the store, until a
+// decodable one is found at index i.
+// load returns nil if no such image is left.
+func (st *imageStore) load(i int) image.Image {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	for i < len(st.entries) {
+		st.cur = i
+		img, err := st.decode(st.entries[i])
+		if err == nil {
+			return img
+		}
+		st.remove(i)
+	}
+	return nil
+}
+
+// discard removes the i-th image file from the store.
+func (st *imageStore) discard(i int) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.remove(i)
+}
+
+// show returns the i-th image, decoding it if needed, and marks it as the
+// displayed one.
+func (st *imageStore) show(i int) (image.Image, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.cur = i
+	return st.decode(st.entries[i])
+}
+
+// ready is like show, but it doesn't wait for the i-th image to be decoded:
+// it reports whether the image, or the error decoding it, is available.
+func (st *imageStore) ready(i int) (image.Image, bool, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.cur = i
+	it := st.entries[i]
+	switch {
+	case it.err != nil:
+		return nil, true, it.err
+	case it.img == nil:
+		return nil, false, nil
+	}
+	st.clock++
+	it.used = st.clock
+	return it.img, true, nil
+}
+
+// add appends files to the store, and returns the index of the first one.
+func (st *imageStore) add(files ...string) int {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	n := len(st.entries)
+	for _, f := range files {
+		st.entries = append(st.entries, newEntry(f))
+	}
+	st.archives = append(st.archives, retainArchives(files)...)
+	return n
+}
+
+// remove removes the i-th image file from the store.
+// st.mu must be held by the caller.
+func (st *imageStore) remove(i int) {
+	st.entries = append(st.entries[:i], st.entries[i+1:]...)
+	if st.cur > i {
+		st.cur--
+	}
+}
+
+// evict drops the least recently used decoded images until at most max
+// of them are left in memory.
+// st.mu must be held by the caller.
+func (st *imageStore) evict() {
+	for {
+		n := 0
+		var lru *entry
+		for i, it := range st.entries {
+			if it.img == nil {
+				continue
+			}
+			n++
+			if i == st.cur || it.modified {
+				continue
+			}
+			if lru == nil || it.used < lru.used {
+				lru = it
+			}
+		}
+		if n <= st.max || lru == nil {
+			return
+		}
+		log.Printf("Evicting '%s' from the image cache.", lru.path)
+		lru.img = nil
+	}
+}
+
+// prefetch asynchronously decodes the images at the given indices.
+// Any previously requested prefetch still pending is cancelled.
+func (st *imageStore) prefetch(idx ...int) {
+	st.request(prefetchReq{}, idx)
+}
+
+// thumbnail returns the thumbnail of the i-th image, or nil if it hasn't
+// been generated yet.
+func (st *imageStore) thumbnail(i int) image.Image {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.entries[i].thumb
+}
+
+// makeThumbnails asynchronously generates the thumbnails of the images at
+// the given indices, calling done once for each of them, and returns the
+// generation of the request. Any previously requested prefetch still
+// pending is cancelled.
+func (st *imageStore) makeThumbnails(idx []int, done func()) uint64 {
+	return st.request(prefetchReq{thumbs: true, done: done}, idx)
+}
+
+// latest reports whether the request of generation gen is the latest one,
+// i.e. whether it is still being worked on, unless it is done.
+func (st *imageStore) latest(gen uint64) bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return gen == st.gen
+}
+
+// request hands req over to the prefetcher, for the images at the given
+// indices, and returns its generation.
+func (st *imageStore) request(req prefetchReq, idx []int) uint64 {
+	st.mu.Lock()
+	st.gen++
+	req.gen = st.gen
+	for _, i := range idx {
+		req.entries = append(req.entries, st.entries[i])
+	}
+	st.mu.Unlock()
+
+	for {
+		select {
+		case st.reqs <- req:
+			return req.gen
+		case <-st.quit:
+			return req.gen
+		default:
+			// drop the stale request.
+			select {
+			case <-st.reqs:
+			default:
+			}
+		}
+	}
+}
+
+// prefetcher hands out the images of the prefetch requests to the workers,
+// one at a time. It stops working on a request as soon as a newer one has
+// been made, and stops the workers once the store is closed.
+func (st *imageStore) prefetcher() {
+	defer close(st.jobs)
+	for {
+		var req prefetchReq
+		select {
+		case req = <-st.reqs:
+		case <-st.quit:
+			return
+		}
+		for _, it := range req.entries {
+			st.mu.Lock()
+			stale := req.gen != st.gen
+			st.mu.Unlock()
+			if stale {
+				break
+			}
+			select {
+			case st.jobs <- prefetchJob{req, it}:
+			case <-st.quit:
+				return
+			}
+		}
+	}
+}
+
+// prefetchJob is an image of a prefetch request, to be decoded by a worker.
+type prefetchJob struct {
+	req prefetchReq
+	it  *entry
+}
+
+// worker decodes the images handed out by the prefetcher. Several workers
+// run concurrently, to bound the number of files decoded at once.
+func (st *imageStore) worker() {
+	for job := range st.jobs {
+		req, it := job.req, job.it
+		st.mu.Lock()
+		switch {
+		case req.gen != st.gen:
+			// the request was superseded while the job was waiting.
+		case !req.thumbs:
+			// errors are logged, and kept for when the image is
+			// displayed.
+			st.decode(it)
+		case it.thumb == nil:
+			img, err := st.decode(it)
+			if err != nil {
+				img = brokenImage()
+			}
+			st.mu.Unlock()
+			thumb := thumbnail(img, thumbSize)
+			st.mu.Lock()
+			if it.thumb != nil {
+				// another worker generated it meanwhile, and reported
+				// it already.
+				break
+			}
+			it.thumb = thumb
+
+			st.mu.Unlock()
+			req.done()
+			st.mu.Lock()
+		}
+		st.mu.Unlock()
+	}
+}
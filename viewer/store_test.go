@@ -0,0 +1,92 @@
+package viewer
+
+import (
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// tempImages writes n small PNG files into a temporary directory, and
+// returns their paths.
+func tempImages(t *testing.T, n int) []string {
+	t.Helper()
+	dir := t.TempDir()
+	var files []string
+	for i := 0; i < n; i++ {
+		path := filepath.Join(dir, fmt.Sprintf("%d.png", i))
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = png.Encode(f, image.NewGray(image.Rect(0, 0, i+1, i+1)))
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, path)
+	}
+	return files
+}
+
+func TestStoreEviction(t *testing.T) {
+	st := newImageStore(tempImages(t, 5), 2, 0)
+	defer st.close()
+
+	// decoded returns the indices of the images kept in memory.
+	decoded := func() []int {
+		st.mu.Lock()
+		defer st.mu.Unlock()
+		var idx []int
+		for i, it := range st.entries {
+			if it.img != nil {
+				idx = append(idx, i)
+			}
+		}
+		return idx
+	}
+
+	for _, tc := range []struct {
+		name string
+		do   func() error
+		want []int
+	}{
+		{"show", func() error { _, err := st.show(0); return err }, []int{0}},
+		{"fill", func() error { _, err := st.get(1); return err }, []int{0, 1}},
+		{
+			// 1 is the least recently used image, after the current one.
+			"past limit", func() error { _, err := st.get(2); return err },
+			[]int{0, 2},
+		},
+		{
+			// the modified image can't be decoded again: 2 goes instead.
+			"modified", func() error {
+				st.set(3, image.NewGray(image.Rect(0, 0, 1, 1)))
+				return nil
+			},
+			[]int{0, 3},
+		},
+		{
+			// 0 isn't the current image anymore, unlike 4.
+			"current", func() error { _, err := st.show(4); return err },
+			[]int{3, 4},
+		},
+		{
+			// the least recently used image isn't evicted when it is the
+			// only one that could be.
+			"only modified and current", func() error { _, err := st.get(1); return err },
+			[]int{3, 4},
+		},
+	} {
+		if err := tc.do(); err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if got := decoded(); fmt.Sprint(got) != fmt.Sprint(tc.want) {
+			t.Errorf("%s: decoded images = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package viewer
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"io"
+	"math"
+
+	"github.com/srwiley/oksvg"
+	"github.com/srwiley/rasterx"
+)
+
+// vectorImage is a decoded SVG image. It is rasterized at its natural size,
+// and can be rasterized again at any scale so that it stays crisp when the
+// user zooms in.
+type vectorImage struct {
+	*image.RGBA
+	icon *oksvg.SvgIcon
+}
+
+// decodeSVG decodes the SVG image read from r.
+func decodeSVG(r io.Reader) (*vectorImage, error) {
+	icon, err := oksvg.ReadIconStream(r)
+	if err != nil {
+		return nil, err
+	}
+	w := int(math.Ceil(icon.ViewBox.W))
+	h := int(math.Ceil(icon.ViewBox.H))
+	if w <= 0 || h <= 0 {
+		return nil, fmt.Errorf("invalid SVG view box %vx%v",
+			icon.ViewBox.W, icon.ViewBox.H)
+	}
+
+	v := &vectorImage{
+		RGBA: image.NewRGBA(image.Rect(0, 0, w, h)),
+		icon: icon,
+	}
+	v.rasterize(v.RGBA, image.Rectangle{Max: image.Point{w, h}})
+	return v, nil
+}
+
+// rasterize draws the image into dst, which starts at (0, 0), scaled to fit
+// into full, in the coordinates of dst.
+func (v *vectorImage) rasterize(dst *image.RGBA, full image.Rectangle) {
+	w, h := dst.Bounds().Dx(), dst.Bounds().Dy()
+	v.icon.SetTarget(float64(full.Min.X), float64(full.Min.Y),
+		float64(full.Dx()), float64(full.Dy()))
+	scanner := rasterx.NewScannerGV(w, h, dst, dst.Bounds())
+	v.icon.Draw(rasterx.NewDasher(w, h, scanner), 1)
+}
+
+// drawScaled draws the part vis of the image into dst, when the whole image
+// is scaled to full.
+func (v *vectorImage) drawScaled(dst draw.Image, full, vis image.Rectangle, op draw.Op) {
+	buf := image.NewRGBA(image.Rectangle{Max: vis.Size()})
+	v.rasterize(buf, full.Sub(vis.Min))
+	draw.Draw(dst, vis, buf, image.Point{}, op)
+}
@@ -0,0 +1,99 @@
+package viewer
+
+import (
+	"image"
+	"image/draw"
+	"log"
+
+	"golang.org/x/exp/shiny/screen"
+)
+
+// texCache holds the texture the last image displayed was uploaded to, or
+// no texture if it couldn't be.
+type texCache struct {
+	src image.Image
+	tex screen.Texture
+}
+
+// release releases the texture, if any.
+func (c *texCache) release() {
+	if c.tex != nil {
+		c.tex.Release()
+	}
+	*c = texCache{}
+}
+
+// texture returns a texture holding img, uploading it if needed. It returns
+// nil if textures aren't supported, e.g. because img is too large for the
+// driver.
+func (w *window) texture(img image.Image) screen.Texture {
+	if w.texCache.src == img {
+		return w.texCache.tex
+	}
+	w.texCache.release()
+	if w.noTexture {
+		return nil
+	}
+
+	b := img.Bounds()
+	tex, err := w.s.NewTexture(b.Size())
+	if err != nil {
+		if w.opts.Verbose {
+			log.Printf("Could not create a texture, drawing on the CPU: %v", err)
+		}
+		// the image may only be too large: the next ones are given a
+		// chance, unless even a tiny texture can't be created.
+		if small, err := w.s.NewTexture(image.Point{1, 1}); err != nil {
+			w.noTexture = true
+		} else {
+			small.Release()
+		}
+		w.texCache = texCache{src: img}
+		return nil
+	}
+	buf, err := w.s.NewBuffer(b.Size())
+	if err != nil {
+		tex.Release()
+		w.texCache = texCache{src: img}
+		return nil
+	}
+	defer buf.Release()
+	draw.Draw(buf.RGBA(), buf.Bounds(), img, b.Min, draw.Src)
+	tex.Upload(image.Point{}, buf, buf.Bounds())
+
+	w.texCache = texCache{src: img, tex: tex}
+	return tex
+}
+
+// canUseTexture reports whether the current image can be displayed from a
+// texture, scaled by the driver. Only the plain image can: the checkerboard
+// and the overlays are drawn on the CPU, in the buffer. The driver doesn't
+// honor the choice of an interpolation either, nor smooths the images it
+// shrinks.
+func (w *window) canUseTexture(img image.Image) bool {
+	if w.interp != interpDefault || w.scale(img) < 1 {
+		return false
+	}
+	if _, ok := img.(*vectorImage); ok && w.scale(img) > 1 {
+		return false
+	}
+	return !w.noTexture && !w.opts.Checker && !w.info && !w.histogram &&
+		!w.inspect && !w.cropping && !w.interpDiff && w.store.decodeErr(w.i) == nil &&
+		w.store.orientation(w.i) == 1
+}
+
+// displayTexture displays the part sr of img into the part dr of the window,
+// letting the driver scale it (on the GPU, where available). It reports
+// whether it succeeded.
+func (w *window) displayTexture(img image.Image, sr, dr image.Rectangle) bool {
+	tex := w.texture(img)
+	if tex == nil {
+		return false
+	}
+	w.w.Fill(w.sz.Bounds(), w.background(img), draw.Src)
+	if !sr.Empty() {
+		w.w.Scale(dr, tex, sr.Sub(img.Bounds().Min), draw.Over, nil)
+	}
+	w.w.Publish()
+	return true
+}
@@ -0,0 +1,59 @@
+package viewer
+
+import (
+	"fmt"
+	"image/color"
+)
+
+// theme is a coordinated palette of the colors of the overlays, and of the
+// default background.
+type theme struct {
+	background   color.Color
+	overlayBg    color.Color
+	overlayFg    color.Color
+	spinnerDim   color.Color
+	spinnerLit   color.Color
+	gridPending  color.Color
+	gridSelected color.Color
+}
+
+// themes are the palettes which can be picked with Options.Theme.
+var themes = map[string]theme{
+	"dark": {
+		background:   color.Black,
+		overlayBg:    color.RGBA{0x00, 0x00, 0x00, 0xb0},
+		overlayFg:    color.White,
+		spinnerDim:   color.RGBA{0x60, 0x60, 0x60, 0xff},
+		spinnerLit:   color.White,
+		gridPending:  color.RGBA{0x30, 0x30, 0x30, 0xff},
+		gridSelected: color.RGBA{0x30, 0x80, 0xe0, 0xff},
+	},
+	"light": {
+		background:   color.RGBA{0xf0, 0xf0, 0xf0, 0xff},
+		overlayBg:    color.RGBA{0xff, 0xff, 0xff, 0xc0},
+		overlayFg:    color.Black,
+		spinnerDim:   color.RGBA{0xb0, 0xb0, 0xb0, 0xff},
+		spinnerLit:   color.RGBA{0x20, 0x20, 0x20, 0xff},
+		gridPending:  color.RGBA{0xd8, 0xd8, 0xd8, 0xff},
+		gridSelected: color.RGBA{0x20, 0x70, 0xd0, 0xff},
+	},
+}
+
+// defaultTheme is the theme used when none is picked.
+const defaultTheme = "dark"
+
+// useTheme switches the colors of the overlays to the palette of the named
+// theme, the default one if name is "".
+func useTheme(name string) error {
+	if name == "" {
+		name = defaultTheme
+	}
+	t, ok := themes[name]
+	if !ok {
+		return fmt.Errorf("unknown theme %q: must be dark or light", name)
+	}
+	overlayBg, overlayFg = t.overlayBg, t.overlayFg
+	spinnerDim, spinnerLit = t.spinnerDim, t.spinnerLit
+	gridPending, gridSelected = t.gridPending, t.gridSelected
+	return nil
+}
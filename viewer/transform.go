@@ -0,0 +1,137 @@
+package viewer
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/math/f64"
+)
+
+// toRGBA returns img as an *image.RGBA, converting it if needed.
+// The returned image bounds start at (0, 0) when a conversion happens.
+func toRGBA(img image.Image) *image.RGBA {
+	if m, ok := img.(*image.RGBA); ok {
+		return m
+	}
+	b := img.Bounds()
+	m := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(m, m.Bounds(), img, b.Min, draw.Src)
+	return m
+}
+
+// toRGBA64 is like toRGBA, for images with 16 bits per channel.
+func toRGBA64(img image.Image) *image.RGBA64 {
+	if m, ok := img.(*image.RGBA64); ok {
+		return m
+	}
+	b := img.Bounds()
+	m := image.NewRGBA64(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(m, m.Bounds(), img, b.Min, draw.Src)
+	return m
+}
+
+// newRGBA returns an image of bounds r to draw a transformed copy of img
+// into, with 16 bits per channel if img has them, so that they can still
+// be dithered, and 8 bits otherwise.
+func newRGBA(img image.Image, r image.Rectangle) draw.Image {
+	if is16Bit(img) {
+		return image.NewRGBA64(r)
+	}
+	return image.NewRGBA(r)
+}
+
+// movePixels returns a w x h copy of img, whose bounds start at (0, 0),
+// where the pixel of img at (x, y), relative to its top left corner, is
+// moved to at(x, y). The copy keeps 16 bits per channel if img has them.
+func movePixels(img image.Image, w, h int, at func(x, y int) (int, int)) image.Image {
+	sz := img.Bounds().Size()
+	if is16Bit(img) {
+		src, dst := toRGBA64(img), image.NewRGBA64(image.Rect(0, 0, w, h))
+		copyPixels(dst.Pix, dst.Stride, src.Pix, src.Stride, 8, sz, at)
+		return dst
+	}
+	src, dst := toRGBA(img), image.NewRGBA(image.Rect(0, 0, w, h))
+	copyPixels(dst.Pix, dst.Stride, src.Pix, src.Stride, 4, sz, at)
+	return dst
+}
+
+// copyPixels copies the pixels, of bpp bytes each, of the image of size sz
+// held in src to dst, where they are moved as told by at, see movePixels.
+func copyPixels(dst []uint8, dstStride int, src []uint8, srcStride, bpp int,
+	sz image.Point, at func(x, y int) (int, int)) {
+	for y := 0; y < sz.Y; y++ {
+		for x := 0; x < sz.X; x++ {
+			dx, dy := at(x, y)
+			i := y*srcStride + x*bpp
+			j := dy*dstStride + dx*bpp
+			copy(dst[j:j+bpp], src[i:i+bpp])
+		}
+	}
+}
+
+// rotate90 returns a copy of img rotated by 90 degrees, clockwise if cw is
+// true and counter-clockwise otherwise.
+func rotate90(img image.Image, cw bool) image.Image {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	return movePixels(img, h, w, func(x, y int) (int, int) {
+		if cw {
+			return h - 1 - y, x
+		}
+		return y, w - 1 - x
+	})
+}
+
+// rotateAngle returns a copy of img rotated clockwise by deg degrees.
+// The copy is large enough to contain the whole rotated image, and the
+// corners it doesn't cover are filled with bg.
+func rotateAngle(img image.Image, deg float64, bg color.Color) image.Image {
+	b := img.Bounds()
+	w, h := float64(b.Dx()), float64(b.Dy())
+	sin, cos := math.Sincos(deg * math.Pi / 180)
+	dw := math.Ceil(math.Abs(w*cos) + math.Abs(h*sin) - 1e-9)
+	dh := math.Ceil(math.Abs(w*sin) + math.Abs(h*cos) - 1e-9)
+	dst := newRGBA(img, image.Rect(0, 0, max(1, int(dw)), max(1, int(dh))))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(bg), image.Point{}, draw.Src)
+
+	// the matrix rotates the image around its center, and moves that
+	// center to the one of dst.
+	cx, cy := float64(b.Min.X)+w/2, float64(b.Min.Y)+h/2
+	dcx, dcy := dw/2, dh/2
+	m := f64.Aff3{
+		cos, -sin, dcx - cos*cx + sin*cy,
+		sin, cos, dcy - sin*cx - cos*cy,
+	}
+	xdraw.BiLinear.Transform(dst, m, img, b, draw.Over, nil)
+	return dst
+}
+
+// flipImage returns a mirrored copy of img, flipped around its vertical
+// axis if horizontal is true and around its horizontal axis otherwise.
+func flipImage(img image.Image, horizontal bool) image.Image {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	return movePixels(img, w, h, func(x, y int) (int, int) {
+		if horizontal {
+			return w - 1 - x, y
+		}
+		return x, h - 1 - y
+	})
+}
+
+// thumbnail returns a copy of img scaled down, preserving its aspect ratio,
+// so that it fits in a size x size square. Small images are left as is.
+func thumbnail(img image.Image, size int) image.Image {
+	b := img.Bounds()
+	if b.Dx() <= size && b.Dy() <= size {
+		return img
+	}
+	w, h := size, b.Dy()*size/b.Dx()
+	if b.Dy() > b.Dx() {
+		w, h = b.Dx()*size/b.Dy(), size
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, max(1, w), max(1, h)))
+	xdraw.BiLinear.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+	return dst
+}
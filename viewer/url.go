@@ -0,0 +1,73 @@
+package viewer
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// httpClient fetches the images given as URLs. Its timeout is set from
+// Options.Timeout.
+var httpClient = &http.Client{}
+
+// IsURL reports whether path is the http or https URL of an image, rather
+// than the path of a file.
+func IsURL(path string) bool {
+	return strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://")
+}
+
+// fetch downloads the image at url into memory, unless a fresh copy of it
+// is cached.
+func fetch(url string) (io.ReadSeekCloser, error) {
+	cached, meta := cache.lookup(url)
+	if cached != nil && time.Now().Before(meta.Expires) {
+		return memFile{bytes.NewReader(cached)}, nil
+	}
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if cached != nil {
+		// the server tells whether the cached copy is still good.
+		if meta.ETag != "" {
+			req.Header.Set("If-None-Match", meta.ETag)
+		}
+		if meta.LastModified != "" {
+			req.Header.Set("If-Modified-Since", meta.LastModified)
+		}
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch '%s': %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		cache.revalidated(url, resp.Header)
+		return memFile{bytes.NewReader(cached)}, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("could not fetch '%s': %s", url, resp.Status)
+	}
+	// servers don't always know the type of what they serve: only the
+	// content known not to be an image is refused.
+	if ct := resp.Header.Get("Content-Type"); ct != "" {
+		typ, _, err := mime.ParseMediaType(ct)
+		if err == nil && !strings.HasPrefix(typ, "image/") &&
+			typ != "application/octet-stream" {
+			return nil, fmt.Errorf("'%s' isn't an image but %s", url, typ)
+		}
+	}
+
+	buf, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch '%s': %w", url, err)
+	}
+	cache.store(url, buf, resp.Header)
+	return memFile{bytes.NewReader(buf)}, nil
+}
@@ -0,0 +1,177 @@
+package viewer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// urlCache caches the images fetched from their URLs on disk, so that they
+// aren't downloaded again by the next runs of the viewer. Each image is
+// stored in a file named after the hash of its URL, along with a ".json"
+// file holding the HTTP headers needed to check whether it is still fresh.
+type urlCache struct {
+	dir string        // "" when caching is disabled
+	ttl time.Duration // how long the images are kept since they were fetched
+}
+
+// cache is the cache of the images fetched from URLs. It is set from
+// Options.URLCache and Options.URLCacheTTL.
+var cache urlCache
+
+// URLCacheDir returns the default directory of the cache of the images
+// fetched from URLs, under the user's cache directory.
+func URLCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "iview", "urls"), nil
+}
+
+// cachedURL is what is known of a cached image, stored alongside it.
+type cachedURL struct {
+	URL          string    `json:"url"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	Expires      time.Time `json:"expires"` // when the image must be checked again
+}
+
+// path returns the path of the cached copy of the image at url.
+func (c urlCache) path(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:]))
+}
+
+// lookup returns the cached copy of the image at url, if any, and what is
+// known of it. It returns a nil copy if the image has to be fetched again.
+func (c urlCache) lookup(url string) ([]byte, *cachedURL) {
+	if c.dir == "" {
+		return nil, nil
+	}
+	path := c.path(url)
+	fi, err := os.Stat(path + ".json")
+	if err != nil || time.Since(fi.ModTime()) > c.ttl {
+		return nil, nil
+	}
+	raw, err := os.ReadFile(path + ".json")
+	if err != nil {
+		return nil, nil
+	}
+	var meta cachedURL
+	if err := json.Unmarshal(raw, &meta); err != nil || meta.URL != url {
+		return nil, nil
+	}
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil
+	}
+	return buf, &meta
+}
+
+// store caches the image buf fetched from url, unless the headers h of the
+// response forbid it.
+func (c urlCache) store(url string, buf []byte, h http.Header) {
+	if c.dir == "" {
+		return
+	}
+	meta, ok := c.headers(url, h)
+	if !ok {
+		return
+	}
+	if err := os.MkdirAll(c.dir, 0o755); err != nil {
+		log.Printf("Could not cache '%s': %v", url, err)
+		return
+	}
+	path := c.path(url)
+	if err := os.WriteFile(path, buf, 0o644); err != nil {
+		log.Printf("Could not cache '%s': %v", url, err)
+		return
+	}
+	c.storeMeta(path, meta)
+}
+
+// revalidated records that the cached copy of the image at url is still
+// fresh, according to the headers h of the response of the server.
+func (c urlCache) revalidated(url string, h http.Header) {
+	if meta, ok := c.headers(url, h); ok {
+		c.storeMeta(c.path(url), meta)
+	}
+}
+
+func (c urlCache) storeMeta(path string, meta cachedURL) {
+	raw, err := json.Marshal(meta)
+	if err == nil {
+		err = os.WriteFile(path+".json", raw, 0o644)
+	}
+	if err != nil {
+		log.Printf("Could not cache '%s': %v", meta.URL, err)
+		os.Remove(path)
+	}
+}
+
+// clean removes the images cached for longer than the cache TTL.
+func (c urlCache) clean() {
+	if c.dir == "" {
+		return
+	}
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			log.Print(err)
+		}
+		return
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		fi, err := e.Info()
+		if err != nil || time.Since(fi.ModTime()) <= c.ttl {
+			continue
+		}
+		path := filepath.Join(c.dir, strings.TrimSuffix(name, ".json"))
+		os.Remove(path)
+		os.Remove(path + ".json")
+	}
+}
+
+// headers returns what is known of the image fetched from url from the
+// headers h of the response. ok is false if the image must not be cached.
+// Without any indication of the server, the image is deemed fresh until it
+// expires from the cache.
+func (c urlCache) headers(url string, h http.Header) (meta cachedURL, ok bool) {
+	meta = cachedURL{
+		URL:          url,
+		ETag:         h.Get("ETag"),
+		LastModified: h.Get("Last-Modified"),
+		Expires:      time.Now().Add(c.ttl),
+	}
+	if t, err := http.ParseTime(h.Get("Expires")); err == nil {
+		meta.Expires = t
+	}
+	for _, d := range strings.Split(h.Get("Cache-Control"), ",") {
+		d = strings.ToLower(strings.TrimSpace(d))
+		switch {
+		case d == "no-store":
+			return meta, false
+		case d == "no-cache":
+			meta.Expires = time.Time{}
+		case strings.HasPrefix(d, "max-age="):
+			if s, err := strconv.Atoi(d[len("max-age="):]); err == nil {
+				meta.Expires = time.Now().Add(time.Duration(s) * time.Second)
+			}
+		}
+	}
+	return meta, true
+}
@@ -0,0 +1,85 @@
+package viewer
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestURLCache(t *testing.T) {
+	saved := cache
+	t.Cleanup(func() { cache = saved })
+
+	const (
+		body    = "\x89PNG fake image"
+		etag    = `"v1"`
+		lastMod = "Mon, 12 Oct 2026 10:00:00 GMT"
+	)
+	for _, tc := range []struct {
+		name   string
+		header map[string]string // headers of the responses
+		gets   int               // number of requests the server receives
+		cached bool              // whether the image is cached in the end
+		cond   bool              // whether the second request is conditional
+	}{
+		{"no headers", nil, 1, true, false},
+		{"no-store", map[string]string{"Cache-Control": "no-store", "ETag": etag}, 2, false, false},
+		{"max-age", map[string]string{"Cache-Control": "max-age=3600"}, 1, true, false},
+		{"expired max-age", map[string]string{"Cache-Control": "max-age=0", "ETag": etag}, 2, true, true},
+		{"no-cache", map[string]string{"Cache-Control": "no-cache", "ETag": etag}, 2, true, true},
+		{
+			"no-cache last modified",
+			map[string]string{"Cache-Control": "no-cache", "Last-Modified": lastMod},
+			2, true, true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cache = urlCache{dir: t.TempDir(), ttl: time.Hour}
+			var (
+				gets int
+				cond bool
+			)
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gets++
+				for k, v := range tc.header {
+					w.Header().Set(k, v)
+				}
+				cond = r.Header.Get("If-None-Match") != "" || r.Header.Get("If-Modified-Since") != ""
+				if r.Header.Get("If-None-Match") == etag || r.Header.Get("If-Modified-Since") == lastMod {
+					w.WriteHeader(http.StatusNotModified)
+					return
+				}
+				w.Header().Set("Content-Type", "image/png")
+				io.WriteString(w, body)
+			}))
+			defer srv.Close()
+
+			url := srv.URL + "/image.png"
+			for i := 0; i < 2; i++ {
+				f, err := fetch(url)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, err := io.ReadAll(f)
+				f.Close()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(got) != body {
+					t.Errorf("fetch %d = %q, want %q", i, got, body)
+				}
+			}
+			if gets != tc.gets {
+				t.Errorf("%d requests, want %d", gets, tc.gets)
+			}
+			if gets > 1 && cond != tc.cond {
+				t.Errorf("conditional second request = %v, want %v", cond, tc.cond)
+			}
+			if buf, _ := cache.lookup(url); (buf != nil) != tc.cached {
+				t.Errorf("cached = %v, want %v", buf != nil, tc.cached)
+			}
+		})
+	}
+}
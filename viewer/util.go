@@ -0,0 +1,68 @@
+package viewer
+
+import (
+	"image"
+	"strings"
+	"sync"
+
+	"golang.design/x/clipboard"
+)
+
+// vpCenter inspects the canvas and image geometry, and determines where the
+// origin of the image should be painted into the canvas.
+// If the image is bigger than the canvas, this is always (0, 0).
+// If the image is the same size, then it is also (0, 0).
+// If a dimension of the image is smaller than the canvas, then:
+// x = (canvas_width - image_width) / 2 and
+// y = (canvas_height - image_height) / 2
+// Both dimensions are handled independently, and only the size of the image
+// matters, not the origin of its bounds.
+func vpCenter(ximg image.Image, canWidth, canHeight int) image.Point {
+	xmargin, ymargin := 0, 0
+	if ximg.Bounds().Dx() < canWidth {
+		xmargin = (canWidth - ximg.Bounds().Dx()) / 2
+	}
+	if ximg.Bounds().Dy() < canHeight {
+		ymargin = (canHeight - ximg.Bounds().Dy()) / 2
+	}
+	return image.Point{xmargin, ymargin}
+}
+
+// basename retrieves the basename of a file path.
+func basename(fName string) string {
+	if lslash := strings.LastIndex(fName, "/"); lslash != -1 {
+		fName = fName[lslash+1:]
+	}
+	return fName
+}
+
+var (
+	clipboardOnce sync.Once
+	clipboardErr  error
+)
+
+// copyToClipboard writes the text s to the system clipboard.
+func copyToClipboard(s string) error {
+	clipboardOnce.Do(func() {
+		clipboardErr = clipboard.Init()
+	})
+	if clipboardErr != nil {
+		return clipboardErr
+	}
+	clipboard.Write(clipboard.FmtText, []byte(s))
+	return nil
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
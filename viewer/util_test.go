@@ -0,0 +1,32 @@
+package viewer
+
+import (
+	"image"
+	"testing"
+)
+
+func TestVpCenter(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		img  image.Rectangle
+		w, h int
+		want image.Point
+	}{
+		{"equal", image.Rect(0, 0, 600, 400), 600, 400, image.Point{0, 0}},
+		{"larger", image.Rect(0, 0, 1200, 900), 600, 400, image.Point{0, 0}},
+		{"smaller", image.Rect(0, 0, 200, 100), 600, 400, image.Point{200, 150}},
+		{"odd margin", image.Rect(0, 0, 201, 101), 600, 400, image.Point{199, 149}},
+		{"wider", image.Rect(0, 0, 1200, 100), 600, 400, image.Point{0, 150}},
+		{"taller", image.Rect(0, 0, 200, 900), 600, 400, image.Point{200, 0}},
+		{"offset bounds", image.Rect(50, 50, 250, 150), 600, 400, image.Point{200, 150}},
+		{"empty canvas", image.Rect(0, 0, 200, 100), 0, 0, image.Point{0, 0}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := vpCenter(tc.img, tc.w, tc.h)
+			if got != tc.want {
+				t.Errorf("vpCenter(%v, %d, %d) = %v, want %v",
+					tc.img, tc.w, tc.h, got, tc.want)
+			}
+		})
+	}
+}
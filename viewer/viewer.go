@@ -0,0 +1,461 @@
+// Package viewer implements the image viewer window of iview, so that it
+// can be embedded in other programs.
+//
+// A Viewer is created with New, from a shiny screen and a set of Options,
+// and runs its event loop until the user quits:
+//
+//	driver.Main(func(s screen.Screen) {
+//		v, err := viewer.New(s, viewer.Options{Files: files})
+//		if err != nil {
+//			log.Fatal(err)
+//		}
+//		v.Run()
+//	})
+package viewer
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"log"
+	"math"
+	"runtime"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/shiny/screen"
+)
+
+// Options configures a Viewer.
+type Options struct {
+	// Files lists the image files to display, in order.
+	Files []string
+
+	// If set, the image displayed instead of decoding Files, e.g. raw
+	// pixels read from stdin. Files then only holds its name, "image" by
+	// default. The image isn't backed by a file: it can't be deleted,
+	// moved or saved.
+	Image image.Image
+
+	// The initial width and height of the window. They default to 600.
+	Width, Height int
+
+	// The minimum width and height of the window, if any. The window is
+	// enlarged back when it is resized below them.
+	MinWidth, MinHeight int
+
+	// If set, the window is sized to the first image instead. An image
+	// larger than the display is shrunk to fit into it.
+	AutoResize bool
+
+	// If set, the window is centered on the primary display.
+	Center bool
+
+	// The zoom factor of the images when they are first displayed. It
+	// defaults to 1.
+	Zoom float64
+
+	// The increment (in pixels) used to pan the image with the keyboard.
+	// It defaults to 20.
+	StepIncrement int
+
+	// The factor by which the increment grows, at most, while a panning
+	// key is held down. It defaults to 8; 1 keeps the increment constant.
+	PanAcceleration float64
+
+	// The quality, from 1 to 100, of the JPEG images written when saving
+	// the transformed images. It defaults to 90, and doesn't affect the
+	// other formats.
+	Quality int
+
+	// The maximum number of decoded images kept in memory. It defaults
+	// to 16.
+	CacheSize int
+
+	// The maximum number of images decoded concurrently in the
+	// background. It defaults to the number of CPUs.
+	Jobs int
+
+	// The color of the window background, around the image. It defaults
+	// to the background of the theme: black for the dark one.
+	Background color.Color
+
+	// If set, the background color is taken from the corners of each
+	// displayed image instead, and Background is only used behind their
+	// transparent parts.
+	BackgroundFromImage bool
+
+	// Whether a checkerboard is drawn behind the images, to reveal their
+	// transparent regions. The rest of the window keeps the background
+	// color.
+	Checker bool
+
+	// If set, the color filter is kept when going to another image,
+	// instead of being reset.
+	KeepFilter bool
+
+	// If set, images with 16 bits per channel are truncated to the 8 bits
+	// of the window, instead of being dithered.
+	NoDither bool
+
+	// If set, the window is resized to the aspect ratio of the image
+	// whenever the user resizes it.
+	LockAspect bool
+
+	// If set, the files which can't be decoded are dropped from the list
+	// of images. Otherwise, a placeholder is displayed instead, along with
+	// the error.
+	SkipErrors bool
+
+	// If set, going to the next image from the last one, or to the
+	// previous image from the first one, does nothing instead of wrapping
+	// around.
+	NoWrap bool
+
+	// If set, only the first image is shown, until the user quits: the
+	// keys showing other images are disabled, and so are file drops.
+	Once bool
+
+	// If set, FindFiles turns the paths of the files and directories
+	// dropped onto the windows into the images to display, e.g. the way
+	// the arguments of the command line are. Otherwise, the dropped files
+	// are displayed as they are, and the directories are skipped.
+	FindFiles func(paths []string) []string
+
+	// If set, the view is reset when going to another image. Otherwise,
+	// the panning offset and zoom of each image are restored when going
+	// back to it.
+	ResetView bool
+
+	// If set, the image can be panned out of the window. Otherwise, a
+	// sliver of it is always kept visible.
+	UnboundedPan bool
+
+	// If set, the image stops as soon as the mouse is released after
+	// dragging it, instead of sliding on and slowing down.
+	NoMomentum bool
+
+	// The directory the images are moved to with the 'v' key, if any.
+	MoveTo string
+
+	// Whether informational messages are logged.
+	Verbose bool
+
+	// If set, the pan and zoom of the windows are synchronized: changing
+	// them in a window changes them in the other ones.
+	Sync bool
+
+	// How long fetching the images given as URLs may take before giving
+	// up, if limited.
+	Timeout time.Duration
+
+	// The directory where the images fetched from URLs are cached, e.g.
+	// URLCacheDir, or "" to always fetch them.
+	URLCache string
+
+	// How long the images fetched from URLs are kept in the cache. It
+	// defaults to a week.
+	URLCacheTTL time.Duration
+
+	// The palette of the overlays and of the default background: "dark",
+	// the default, or "light". As the colors are shared by the whole
+	// package, the theme of the last viewer created wins.
+	Theme string
+
+	// If set, high density displays are handled as standard ones.
+	// Otherwise, the window and the overlay text are enlarged on them, by
+	// the ratio of their density to 96 dots per inch, rounded.
+	NoHiDPI bool
+
+	// The path of a key configuration file overriding the default key
+	// bindings. See KeyConfigPath.
+	KeyConfig string
+
+	// The interpolation used to scale the images: one of "nearest",
+	// "bilinear" or "catmullrom". Nearest neighbor suits pixel art best,
+	// and Catmull-Rom photos. By default, the images are shrunk with
+	// Catmull-Rom, and enlarged with a fast approximation of bilinear
+	// interpolation.
+	Interp string
+
+	// The ratio of the width to the height of the pixels of the images,
+	// e.g. 2 for pixels twice as wide as high. The images are stretched so
+	// that their pixels display square. If zero, the ratio recorded in the
+	// files is used, if any, and the pixels are square otherwise.
+	PixelAspect float64
+
+	// The file the size and position of the window are saved to when it
+	// is closed, or "" not to save them. See GeometryPath.
+	GeometryFile string
+
+	// If set, the window is opened with the size and position saved in
+	// GeometryFile, if any, rather than Width and Height. It is ignored
+	// with AutoResize, and the position with Center.
+	RestoreGeometry bool
+}
+
+// withDefaults returns a copy of opts where the zero values are replaced
+// by their defaults.
+func (opts Options) withDefaults() Options {
+	if opts.Width <= 0 {
+		opts.Width = 600
+	}
+	if opts.Height <= 0 {
+		opts.Height = 600
+	}
+	if opts.Zoom <= 0 {
+		opts.Zoom = 1
+	}
+	opts.Zoom = math.Max(minZoom, math.Min(maxZoom, opts.Zoom))
+	if opts.StepIncrement == 0 {
+		opts.StepIncrement = 20
+	}
+	if opts.PanAcceleration < 1 {
+		opts.PanAcceleration = 8
+	}
+	if opts.Quality < 1 || opts.Quality > 100 {
+		opts.Quality = defaultJPEGQuality
+	}
+	if opts.CacheSize < 1 {
+		opts.CacheSize = 16
+	}
+	if opts.Jobs < 1 {
+		opts.Jobs = runtime.NumCPU()
+	}
+	if opts.Background == nil {
+		opts.Background = color.Black
+		if t, ok := themes[opts.Theme]; ok {
+			opts.Background = t.background
+		}
+	}
+	if opts.URLCacheTTL <= 0 {
+		opts.URLCacheTTL = 7 * 24 * time.Hour
+	}
+	return opts
+}
+
+// Viewer displays a list of images, in one or more windows.
+type Viewer struct {
+	s    screen.Screen
+	w    *window // the first window
+	wins sync.WaitGroup
+
+	mu     sync.Mutex
+	open   map[*window]bool // the windows currently open
+	marked []string         // the images marked in the closed windows
+	quit   bool             // whether Quit was called
+}
+
+// New creates the window of a viewer displaying the images of opts.Files.
+// It returns an error if there are none, or if none of them can be decoded
+// and opts.SkipErrors is set.
+func New(s screen.Screen, opts Options) (*Viewer, error) {
+	opts = opts.withDefaults()
+
+	ip, err := parseInterp(opts.Interp)
+	if err != nil {
+		return nil, err
+	}
+	if err := useTheme(opts.Theme); err != nil {
+		return nil, err
+	}
+	httpClient.Timeout = opts.Timeout
+	cache = urlCache{dir: opts.URLCache, ttl: opts.URLCacheTTL}
+	go cache.clean()
+
+	keys := defaultBindings()
+	if opts.KeyConfig != "" {
+		if err := loadKeyConfig(opts.KeyConfig, keys); err != nil {
+			return nil, fmt.Errorf("could not load the key bindings: %w", err)
+		}
+	}
+
+	// Images are decoded on demand, except for the first one which may be
+	// needed to size the window.
+	files := opts.Files
+	switch {
+	case opts.Image != nil && len(files) == 0:
+		files = []string{"image"}
+	case opts.Image != nil, opts.Once && len(files) > 1:
+		files = files[:1]
+	}
+	store := newImageStore(files, opts.CacheSize, opts.Jobs)
+	if opts.Image != nil {
+		store.setVirtual(0, opts.Image)
+	}
+	if store.len() == 0 {
+		return nil, errors.New("no images specified")
+	}
+	var img image.Image
+	if opts.SkipErrors {
+		img = store.load(0)
+		if img == nil {
+			return nil, errors.New("none of the images specified could be shown")
+		}
+	} else {
+		var err error
+		img, err = store.show(0)
+		if err != nil {
+			img = brokenImage()
+		}
+	}
+
+	winSize := image.Point{opts.Width, opts.Height}
+	fit := false
+	var pos *image.Point
+	if opts.RestoreGeometry && opts.GeometryFile != "" && !opts.AutoResize {
+		if g, ok := loadGeometry(opts.GeometryFile); ok {
+			winSize, pos = image.Point{g.Width, g.Height}, g.Position
+		}
+	}
+	// Auto-size the window if appropriate.
+	if opts.AutoResize {
+		b := img.Bounds()
+		winSize = image.Point{
+			max(1, int(math.Round(float64(b.Dx())*opts.Zoom))),
+			max(1, int(math.Round(float64(b.Dy())*opts.Zoom))),
+		}
+		// images larger than the display are fit into it instead.
+		if d, ok := s.(displayBounder); ok {
+			if db := d.DisplayBounds().Size(); winSize.X > db.X || winSize.Y > db.Y {
+				k := math.Min(float64(db.X)/float64(winSize.X), float64(db.Y)/float64(winSize.Y))
+				winSize = image.Point{
+					max(1, int(float64(winSize.X)*k)),
+					max(1, int(float64(winSize.Y)*k)),
+				}
+				fit = true
+			}
+		}
+		log.Printf("Auto-resizing the window to %dx%d, from %s (%dx%d).",
+			winSize.X, winSize.Y, store.name(0), b.Dx(), b.Dy())
+	}
+
+	winSize = image.Point{max(winSize.X, opts.MinWidth), max(winSize.Y, opts.MinHeight)}
+	w, err := newWindow(s, store, winSize, opts, keys)
+	if err != nil {
+		return nil, err
+	}
+	if p, ok := w.w.(positioner); ok && pos != nil && !opts.Center {
+		p.SetPosition(*pos)
+	}
+	v := &Viewer{s: s, w: w, open: make(map[*window]bool)}
+	w.viewer = v
+	w.interp = ip
+	w.fit = fit
+	return v, nil
+}
+
+// Run handles the events of the viewer windows until the user quits or they
+// are closed, then releases them. Each window handles its events in its own
+// goroutine, and Run returns once the last one was closed.
+func (v *Viewer) Run() {
+	v.start(v.w)
+	v.wins.Wait()
+}
+
+// start runs the event loop of the window w in a new goroutine.
+func (v *Viewer) start(w *window) {
+	v.mu.Lock()
+	v.open[w] = true
+	if v.quit {
+		// the window opened as the viewer was being quit.
+		w.w.Send(quitEvent{})
+	}
+	v.mu.Unlock()
+
+	v.wins.Add(1)
+	go func() {
+		defer v.wins.Done()
+		defer func() {
+			v.mu.Lock()
+			delete(v.open, w)
+			v.mark(w.store.marked()...)
+			v.mu.Unlock()
+			// the last window closed is the one remembered.
+			w.saveGeometry()
+			w.release()
+		}()
+
+		w.prefetch()
+		w.run()
+	}()
+}
+
+// clone opens a new window displaying the same image as w, with the same
+// view. The new window has a list of images of its own, so that each window
+// can go to other images, or delete them, independently.
+func (v *Viewer) clone(w *window) {
+	store := newImageStore(w.store.files(), w.opts.CacheSize, w.opts.Jobs)
+	if w.store.modified(w.i) {
+		// the image was e.g. rotated, and not saved yet.
+		if img, err := w.store.get(w.i); err == nil {
+			store.set(w.i, img)
+		}
+	}
+	for i := 0; i < store.len(); i++ {
+		if w.store.isVirtual(i) {
+			img, _ := w.store.get(i)
+			store.setVirtual(i, img)
+		}
+	}
+
+	opts := w.opts
+	opts.Center = false
+	nw, err := newWindow(v.s, store, w.sz.Size(), opts, w.keys)
+	if err != nil {
+		log.Printf("Could not open a new window: %v", err)
+		return
+	}
+	nw.viewer = v
+	nw.i, nw.orig, nw.zoom, nw.fit = w.i, w.orig, w.zoom, w.fit
+	nw.filter, nw.interp, nw.smooth = w.filter, w.interp, w.smooth
+	nw.dpi = w.dpi // the size of w already suits the display.
+	nw.retitle()
+	v.start(nw)
+}
+
+// quitEvent is sent to the windows to close them.
+type quitEvent struct{}
+
+// Quit closes all the windows of the viewer, as if the user quit, so that
+// Run returns. It may be called from any goroutine, e.g. on a signal.
+func (v *Viewer) Quit() {
+	v.mu.Lock()
+	v.quit = true
+	v.mu.Unlock()
+	v.broadcast(nil, quitEvent{})
+}
+
+// broadcast sends the event e to all the open windows, but from.
+func (v *Viewer) broadcast(from *window, e interface{}) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for w := range v.open {
+		if w != from {
+			w.w.Send(e)
+		}
+	}
+}
+
+// mark adds files to the list of marked images. It expects v.mu to be held.
+func (v *Viewer) mark(files ...string) {
+	seen := make(map[string]bool, len(v.marked))
+	for _, f := range v.marked {
+		seen[f] = true
+	}
+	for _, f := range files {
+		if !seen[f] {
+			seen[f] = true
+			v.marked = append(v.marked, f)
+		}
+	}
+}
+
+// Marked returns the paths of the images the user marked, with the 'b' key,
+// in the windows closed so far. It is meant to be called after Run.
+func (v *Viewer) Marked() []string {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return append([]string(nil), v.marked...)
+}
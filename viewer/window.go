@@ -0,0 +1,1531 @@
+package viewer
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/shiny/screen"
+	"golang.org/x/mobile/event/key"
+	"golang.org/x/mobile/event/lifecycle"
+	"golang.org/x/mobile/event/mouse"
+	"golang.org/x/mobile/event/paint"
+	"golang.org/x/mobile/event/size"
+)
+
+// The bounds and the multiplicative step of the zoom factor.
+const (
+	minZoom  = 0.05
+	maxZoom  = 40
+	zoomStep = 1.25
+)
+
+// The following interfaces are implemented by the shiny windows providing
+// features beyond screen.Window. Not all drivers support them.
+type (
+	// titler is implemented by windows whose title can be changed after
+	// they have been created.
+	titler interface {
+		SetTitle(title string)
+	}
+
+	// fullscreener is implemented by windows that can cover the whole
+	// display, without decorations.
+	fullscreener interface {
+		SetFullscreen(full bool)
+	}
+
+	// resizer is implemented by windows that can be resized.
+	resizer interface {
+		Resize(size image.Point)
+	}
+
+	// cursorer is implemented by windows whose mouse cursor can be changed.
+	// Cursors are named after the CSS cursor keywords, e.g. "grabbing".
+	cursorer interface {
+		SetCursor(name string)
+	}
+
+	// positioner is implemented by windows that can be moved, to the
+	// given position of their top left corner on the display.
+	positioner interface {
+		SetPosition(pos image.Point)
+	}
+
+	// locator is implemented by windows reporting the position of their
+	// top left corner on the display.
+	locator interface {
+		Position() image.Point
+	}
+
+	// displayBounder is implemented by the screens reporting the bounds
+	// of their primary display.
+	displayBounder interface {
+		DisplayBounds() image.Rectangle
+	}
+)
+
+// fileDropEvent is implemented by the events of the drivers which report the
+// files dropped onto the window.
+type fileDropEvent interface {
+	Files() []string
+}
+
+// window displays a list of decoded images, one at a time.
+type window struct {
+	viewer  *Viewer
+	s       screen.Screen
+	w       screen.Window
+	b       screen.Buffer
+	bufSize image.Point // allocated size of b, which may exceed sz
+	bufErr  error       // why b couldn't be enlarged to sz, if it couldn't
+	sz      size.Event
+
+	opts Options
+	keys map[keystroke]action // key bindings of the window
+
+	store *imageStore
+	i     int // index of the image to display
+
+	orig image.Point // panning offset of the image, in window pixels
+	pan  bool        // whether the image is being dragged with the mouse
+	last image.Point // last mouse position seen while panning
+
+	paintPending bool // whether a paint event was sent, and not handled yet
+
+	pressed time.Time // when the last key was pressed, to accelerate panning
+	held    key.Code  // the key pressed then, until it's released
+	holding bool      // whether held is still down
+	fine    bool      // whether Control is held with it, to pan by 1 pixel
+
+	drag  []dragSample // recent mouse positions while panning
+	glide *glide       // the image sliding after being flicked, if any
+
+	zoom float64 // magnification applied to the image
+	fit  bool    // whether the image is shrunk to fit inside the window
+
+	// views holds the view state of the images displayed so far, by
+	// index, to restore it when going back to them.
+	views map[int]viewState
+
+	full     bool        // whether the window is in fullscreen mode
+	prevSize image.Point // size of the window before going fullscreen
+
+	info bool // whether the status bar is displayed
+
+	histogram bool // whether the histogram of the image is shown
+	histCache histCache
+
+	inspect bool        // whether the pixel under the cursor is shown
+	cursor  image.Point // last position of the mouse cursor
+
+	// loading holds the entries of the images being decoded in the
+	// background, for display. They are kept by entry, rather than by
+	// index, since images may be removed from the store meanwhile.
+	loading   map[*entry]bool
+	loadStart time.Time // when the current image started loading
+	spinning  bool      // whether the next spinner frame is scheduled
+
+	// dpi is the factor by which the overlay text is enlarged, to suit
+	// the density of the display, or 0 until the window is first sized.
+	dpi int
+
+	// unfocused is true while the window doesn't have the focus: its
+	// animations are then paused.
+	unfocused bool
+
+	filter      filter // color filter applied to the image
+	unoriented  bool   // whether the EXIF orientation of the image is undone
+	orientCache orientCache
+
+	stretchCache stretchCache // the image resampled to square pixels
+	interp       interp       // interpolation used to scale the image
+	interpDiff   bool         // whether the pixels it changes are highlighted
+	smooth       interp       // interpolation restored by toggleInterp
+	filterCache  filterCache
+	ditherCache  ditherCache
+
+	frame   frame // what was last composited into the buffer
+	frameOK bool  // whether the buffer holds frame
+
+	texCache  texCache // texture holding the image, scaled by the driver
+	noTexture bool     // whether textures are known not to work
+
+	grid    bool      // whether the thumbnail grid is displayed
+	gridTop int       // vertical scrolling offset of the grid, in pixels
+	thumbs  *progress // progress of the thumbnails being generated, if any
+
+	// queued holds the images whose thumbnails were requested, with the
+	// generation of the request, so that they are requested once.
+	queued   map[*entry]bool
+	queueGen uint64
+
+	// number holds the digits typed so far to jump to an image.
+	number string
+
+	// angle is true while the user types the angle to rotate the image
+	// by, in which case number holds it.
+	angle bool
+
+	// cropping is true in crop mode, where sel is the area of the image
+	// selected to crop it to, dragged with the mouse from selStart.
+	cropping  bool
+	selecting bool // whether the selection is being dragged
+	sel       image.Rectangle
+	selStart  image.Point
+
+	quit bool // whether the user asked to quit
+
+	// confirmDelete is true when the user asked for the current file to be
+	// deleted, and has to press the delete key again to confirm.
+	confirmDelete bool
+}
+
+func newWindow(s screen.Screen, store *imageStore, winSize image.Point,
+	opts Options, keys map[keystroke]action) (*window, error) {
+
+	win := &window{
+		s:       s,
+		opts:    opts,
+		keys:    keys,
+		store:   store,
+		loading: make(map[*entry]bool),
+		views:   make(map[int]viewState),
+		zoom:    opts.Zoom,
+	}
+	w, err := s.NewWindow(&screen.NewWindowOptions{
+		Width:  winSize.X,
+		Height: winSize.Y,
+		Title:  win.title(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	win.w = w
+	if opts.Center {
+		win.center(winSize)
+	}
+	return win, nil
+}
+
+// center moves the window, of the given size, to the center of the primary
+// display, if the driver allows it.
+func (w *window) center(size image.Point) {
+	d, ok := w.s.(displayBounder)
+	p, ok2 := w.w.(positioner)
+	if !ok || !ok2 {
+		log.Print("Centering the window isn't supported by the shiny driver.")
+		return
+	}
+	b := d.DisplayBounds()
+	p.SetPosition(b.Min.Add(b.Size().Sub(size).Div(2)))
+}
+
+// title returns the window title describing the current image.
+func (w *window) title() string {
+	t := fmt.Sprintf("iview - %s (%d/%d)", w.store.name(w.i), w.i+1, w.store.len())
+	if w.store.isMarked(w.i) {
+		t += " [marked]"
+	}
+	if w.confirmDelete {
+		t += " - press 'd' again to delete"
+	}
+	if w.cropping {
+		t += " - select the area to crop to, then press Enter"
+	}
+	switch {
+	case w.angle:
+		t += " - rotate by: " + w.number + "°"
+	case w.number != "":
+		t += " - go to: " + w.number
+	}
+	return t
+}
+
+// img returns the current image, decoding it if needed.
+// A placeholder is returned when the image can't be decoded.
+func (w *window) img() image.Image {
+	img, err := w.store.show(w.i)
+	if err != nil {
+		return brokenImage()
+	}
+	return w.filtered(w.stretched(w.oriented(img)))
+}
+
+// skip drops the current image, which failed to decode, and goes to the
+// next one. It reports whether there is any image left.
+func (w *window) skip() bool {
+	log.Printf("Skipping '%s'.", w.store.path(w.i))
+	w.store.discard(w.i)
+	if w.store.len() == 0 {
+		log.Print("No images left to show. Quitting...")
+		w.quit = true
+		return false
+	}
+	w.forgetView(w.i)
+	i := w.i
+	if i == w.store.len() {
+		i = 0
+	}
+	w.enter(i)
+	return true
+}
+
+// loadedEvent is sent to the window once the image of an entry of the
+// store has been decoded, or failed to.
+type loadedEvent struct {
+	it *entry
+}
+
+// spinEvent is sent to the window to draw the next frame of the loading
+// spinner.
+type spinEvent struct{}
+
+// spinFrame is the interval between two frames of the loading spinner.
+const spinFrame = 100 * time.Millisecond
+
+// tryImg is like img, but it doesn't block the event loop while the current
+// image is decoded: it decodes it in the background instead, and reports
+// whether the image is available.
+func (w *window) tryImg() (image.Image, bool) {
+	img, ok, err := w.store.ready(w.i)
+	switch {
+	case err != nil && w.opts.SkipErrors:
+		if !w.skip() {
+			return brokenImage(), true
+		}
+		return w.tryImg()
+	case err != nil:
+		return brokenImage(), true
+	case ok:
+		return w.filtered(w.stretched(w.oriented(img))), true
+	}
+
+	if it := w.store.at(w.i); !w.loading[it] {
+		w.loading[it] = true
+		w.loadStart = time.Now()
+		go func() {
+			w.store.getEntry(it)
+			w.w.Send(loadedEvent{it})
+		}()
+	}
+	return nil, false
+}
+
+// transform replaces the current image with the result of f applied to it.
+// Images that can't be decoded are left alone.
+func (w *window) transform(f func(img image.Image) image.Image) {
+	img, err := w.store.get(w.i)
+	if err != nil {
+		return
+	}
+	w.store.set(w.i, f(img))
+}
+
+// retitle updates the window title, if the driver allows it.
+func (w *window) retitle() {
+	if t, ok := w.w.(titler); ok {
+		t.SetTitle(w.title())
+	}
+}
+
+// release releases the resources held by the window.
+func (w *window) release() {
+	w.stopGlide()
+	w.store.close()
+	w.texCache.release()
+	if w.b != nil {
+		w.b.Release()
+	}
+	w.w.Release()
+}
+
+// run processes the window events until the user quits.
+func (w *window) run() {
+	for {
+		// the view before handling the event, to mirror its changes in
+		// the other windows.
+		i, view := w.i, w.view()
+
+		switch e := w.w.NextEvent().(type) {
+		default:
+
+		case syncEvent:
+			w.orig, w.zoom, w.fit = e.view.orig, e.view.zoom, e.view.fit
+			view = e.view
+			w.w.Send(paint.Event{})
+
+		case quitEvent:
+			return
+
+		case lifecycle.Event:
+			// the window was closed, e.g. from its title bar.
+			if e.To == lifecycle.StageDead {
+				return
+			}
+			switch e.Crosses(lifecycle.StageFocused) {
+			case lifecycle.CrossOff:
+				w.unfocused = true
+				w.pauseGlide()
+			case lifecycle.CrossOn:
+				w.unfocused = false
+				w.resumeGlide()
+				// restart the spinner, if the image is still loading.
+				w.w.Send(paint.Event{})
+			}
+
+		case mouse.Event:
+			if w.grid {
+				w.gridMouse(e)
+				break
+			}
+			w.mouse(e)
+
+		case key.Event:
+			if w.grid {
+				if w.gridKey(e) {
+					return
+				}
+				break
+			}
+			if w.key(e) {
+				return
+			}
+
+		case glideEvent:
+			w.stepGlide(e.g)
+
+		case loadedEvent:
+			delete(w.loading, e.it)
+			// the result is stale if the image was removed, or isn't
+			// the current one anymore.
+			if w.store.len() > 0 && w.store.at(w.i) == e.it {
+				w.display()
+			}
+
+		case spinEvent:
+			w.spinning = false
+			if w.store.len() > 0 && w.loading[w.store.at(w.i)] {
+				w.display()
+			}
+
+		case fileDropEvent:
+			w.drop(e.Files())
+
+		case paint.Event:
+			w.paintPending = false
+			w.display()
+			if w.quit {
+				return
+			}
+
+		case size.Event:
+			w.sz = e
+			w.updateDPI(e)
+			resized := w.enforceMinSize()
+			w.newBuffer()
+			w.display()
+			if w.opts.LockAspect && !resized {
+				w.lockAspect()
+			}
+
+		case error:
+			log.Print(e)
+		}
+
+		if w.opts.Sync && w.i == i && w.view() != view {
+			w.viewer.broadcast(w, syncEvent{w.view()})
+		}
+	}
+}
+
+// repaint asks for the window to be painted again, unless it already was
+// and the paint event wasn't handled yet: the mouse moves much more often
+// than the window can be repainted, and the paint events would otherwise
+// pile up while dragging.
+func (w *window) repaint() {
+	if w.paintPending {
+		return
+	}
+	w.paintPending = true
+	w.w.Send(paint.Event{})
+}
+
+// syncEvent is sent to the windows to mirror the view of another one, when
+// views are synchronized.
+type syncEvent struct {
+	view viewState
+}
+
+func (w *window) mouse(e mouse.Event) {
+	pos := image.Point{int(e.X), int(e.Y)}
+	if e.Button.IsWheel() {
+		if e.Direction == mouse.DirRelease {
+			return
+		}
+		switch e.Button {
+		case mouse.ButtonWheelUp:
+			w.unfit()
+			w.setZoomAt(w.zoom*zoomStep, pos)
+		case mouse.ButtonWheelDown:
+			w.unfit()
+			w.setZoomAt(w.zoom/zoomStep, pos)
+		default:
+			return
+		}
+		w.w.Send(paint.Event{})
+		return
+	}
+
+	switch e.Direction {
+	case mouse.DirPress:
+		if e.Button == mouse.ButtonLeft && w.cropping {
+			w.selecting = true
+			w.selStart = w.cropPoint(w.img(), pos)
+			w.selectTo(pos)
+			w.w.Send(paint.Event{})
+			break
+		}
+		if e.Button == mouse.ButtonLeft {
+			w.stopGlide()
+			w.pan = true
+			w.last = pos
+			w.track(pos)
+			w.setCursor("grabbing")
+		}
+	case mouse.DirRelease:
+		if e.Button == mouse.ButtonLeft && w.selecting {
+			w.selecting = false
+			break
+		}
+		if e.Button == mouse.ButtonLeft {
+			w.pan = false
+			w.setCursor("default")
+			w.startGlide()
+		}
+	case mouse.DirNone:
+		w.cursor = pos
+		if w.inspect && !w.pan {
+			w.repaint()
+		}
+		if w.selecting {
+			w.selectTo(pos)
+			w.repaint()
+		}
+		if w.pan {
+			w.panBy(pos.Sub(w.last))
+			w.last = pos
+			w.track(pos)
+			w.repaint()
+		}
+	}
+}
+
+// key handles a key event. It returns true when the user asked to quit.
+func (w *window) key(e key.Event) bool {
+	w.fine = e.Modifiers&key.ModControl != 0
+	switch e.Direction {
+	case key.DirPress:
+		// some drivers, e.g. x11, send the autorepeats of a key held
+		// down as more presses: they don't restart the acceleration.
+		if !w.holding || e.Code != w.held {
+			w.pressed, w.held, w.holding = time.Now(), e.Code, true
+		}
+	case key.DirRelease:
+		if e.Code == w.held {
+			w.holding = false
+		}
+		return false
+	case key.DirNone:
+		// auto-repeated keystrokes only trigger the actions that make
+		// sense to repeat, e.g. to pan smoothly.
+		if act := w.lookupKey(e); repeatable[act] {
+			actions[act](w)
+			w.w.Send(paint.Event{})
+		}
+		return false
+	default:
+		return false
+	}
+
+	confirm := w.confirmDelete
+	title := w.title()
+	if !w.cropKey(e) && !w.numberKey(e) {
+		act := w.lookupKey(e)
+		// any other action than deleting cancels a pending deletion.
+		if act != actDelete {
+			w.confirmDelete = false
+		}
+		if f, ok := actions[act]; ok {
+			f(w)
+			w.w.Send(paint.Event{})
+		}
+	} else {
+		w.confirmDelete = false
+	}
+
+	if w.confirmDelete && !confirm {
+		log.Printf("Press 'd' again to delete '%s'.", w.store.path(w.i))
+	}
+	if !w.quit && w.title() != title {
+		w.retitle()
+	}
+	return w.quit
+}
+
+// numberKey handles the keys used to type the number of an image to jump
+// to. It returns false if e isn't such a key.
+func (w *window) numberKey(e key.Event) bool {
+	if w.angle {
+		return w.angleKey(e)
+	}
+	if w.opts.Once {
+		return false
+	}
+	if r := e.Rune; '0' <= r && r <= '9' &&
+		e.Modifiers&(key.ModControl|key.ModAlt|key.ModMeta) == 0 {
+		// a leading 0 is not part of a number.
+		if r == '0' && w.number == "" {
+			return false
+		}
+		w.number += string(r)
+		return true
+	}
+	if w.number == "" {
+		return false
+	}
+
+	switch e.Code {
+	case key.CodeEscape:
+		w.number = ""
+	case key.CodeDeleteBackspace:
+		w.number = w.number[:len(w.number)-1]
+	case key.CodeReturnEnter, key.CodeKeypadEnter:
+		n, err := strconv.Atoi(w.number)
+		w.number = ""
+		if err != nil {
+			// the number is too large.
+			n = w.store.len()
+		}
+		w.goTo(max(0, min(n, w.store.len())-1))
+		w.w.Send(paint.Event{})
+	default:
+		return false
+	}
+	return true
+}
+
+// angleKey handles the keys typed to enter the angle, in degrees, to rotate
+// the image by. All keys are swallowed until the angle is either confirmed
+// with Enter or dismissed with Escape.
+func (w *window) angleKey(e key.Event) bool {
+	switch r := e.Rune; {
+	case '0' <= r && r <= '9', r == '.', r == '-' && w.number == "":
+		w.number += string(r)
+		return true
+	}
+
+	switch e.Code {
+	case key.CodeEscape:
+		w.angle, w.number = false, ""
+	case key.CodeDeleteBackspace:
+		if w.number != "" {
+			w.number = w.number[:len(w.number)-1]
+		}
+	case key.CodeReturnEnter, key.CodeKeypadEnter:
+		deg, err := strconv.ParseFloat(w.number, 64)
+		w.angle, w.number = false, ""
+		if err != nil {
+			log.Printf("Invalid rotation angle: %v", err)
+			break
+		}
+		w.rotateBy(deg)
+		w.w.Send(paint.Event{})
+	}
+	return true
+}
+
+// next moves on to the next image, wrapping around at the end.
+func (w *window) next() {
+	i := w.i + 1
+	if i == w.store.len() {
+		if w.opts.NoWrap {
+			return
+		}
+		i = 0
+	}
+	w.goTo(i)
+}
+
+// prev moves back to the previous image, wrapping around at the start.
+func (w *window) prev() {
+	i := w.i - 1
+	if i < 0 {
+		if w.opts.NoWrap {
+			return
+		}
+		i = w.store.len() - 1
+	}
+	w.goTo(i)
+}
+
+// toggleFit switches the fit mode on or off.
+func (w *window) toggleFit() {
+	if w.fit {
+		w.unfit()
+	} else {
+		w.fit = true
+	}
+	w.orig = image.Point{}
+}
+
+// actualSize displays the image at its native size, centered in the
+// window, leaving the fit mode.
+func (w *window) actualSize() {
+	w.fit = false
+	w.zoom = 1
+	img := w.img()
+	r := image.Rectangle{Max: w.scaledSize(img)}
+	c := w.sz.Size().Sub(r.Size()).Div(2)
+	w.orig = c.Sub(vpCenter(r, w.sz.WidthPx, w.sz.HeightPx))
+}
+
+// resetView resets the pan and zoom of the image, which no longer fits in
+// the window.
+func (w *window) resetView() {
+	w.orig = image.Point{}
+	w.zoom = w.opts.Zoom
+	w.fit = false
+}
+
+// rotateBy rotates the image clockwise by deg degrees.
+func (w *window) rotateBy(deg float64) {
+	if math.Mod(deg, 360) == 0 {
+		return
+	}
+	bg := w.background(w.img())
+	w.transform(func(img image.Image) image.Image {
+		return rotateAngle(img, deg, bg)
+	})
+	w.orig = image.Point{}
+}
+
+// rotate rotates the current image by 90 degrees, clockwise if cw is true.
+// Transformed images replace the decoded ones, so that the transformation
+// sticks while navigating.
+func (w *window) rotate(cw bool) {
+	w.transform(func(img image.Image) image.Image {
+		return rotate90(img, cw)
+	})
+	w.orig = image.Point{}
+}
+
+// flip mirrors the current image, horizontally if horizontal is true.
+func (w *window) flip(horizontal bool) {
+	w.transform(func(img image.Image) image.Image {
+		return flipImage(img, horizontal)
+	})
+}
+
+// resizeToImage resizes the drawing area to the size of the current image.
+func (w *window) resizeToImage() {
+	r := w.img().Bounds()
+	w.sz.HeightPx = r.Dy()
+	w.sz.WidthPx = r.Dx()
+	w.newBuffer()
+}
+
+// delete deletes the file of the current image, and moves on to the next
+// image. The first call only asks for a confirmation, the deletion happens
+// when delete is called again right after.
+func (w *window) delete() {
+	if !w.confirmDelete {
+		w.confirmDelete = true
+		return
+	}
+	w.confirmDelete = false
+
+	path := w.store.path(w.i)
+	if w.store.isVirtual(w.i) || IsURL(path) {
+		log.Printf("Can't delete '%s': it isn't a file.", path)
+		return
+	}
+	if isArchived(path) {
+		log.Printf("Can't delete '%s' from its archive.", path)
+		return
+	}
+	if isPage(path) {
+		log.Printf("Can't delete a single page of a TIFF file: '%s'.", path)
+		return
+	}
+	if err := os.Remove(path); err != nil {
+		log.Print(err)
+		return
+	}
+	log.Printf("Deleted '%s'.", path)
+
+	w.store.discard(w.i)
+	if w.store.len() == 0 {
+		log.Print("No images left to show. Quitting...")
+		w.quit = true
+		return
+	}
+	w.forgetView(w.i)
+	i := w.i
+	if i == w.store.len() {
+		i = 0
+	}
+	w.enter(i)
+}
+
+// move moves the current image file to the -move-to directory, and shows
+// the next image.
+func (w *window) move() {
+	if w.opts.MoveTo == "" {
+		log.Print("No directory to move the images to: see -move-to.")
+		return
+	}
+	path := w.store.path(w.i)
+	if w.store.isVirtual(w.i) || IsURL(path) {
+		log.Printf("Can't move '%s': it isn't a file.", path)
+		return
+	}
+	if isArchived(path) {
+		log.Printf("Can't move '%s' out of its archive.", path)
+		return
+	}
+	if isPage(path) {
+		log.Printf("Can't move a single page of a TIFF file: '%s'.", path)
+		return
+	}
+	dst, err := moveFile(path, w.opts.MoveTo)
+	if err != nil {
+		log.Print(err)
+		return
+	}
+	log.Printf("Moved '%s' to '%s'.", path, dst)
+
+	w.store.rename(w.i, dst)
+	w.retitle()
+	w.next()
+}
+
+// copyPath copies the absolute path of the current image file, or its URL,
+// to the clipboard.
+func (w *window) copyPath() {
+	path := w.store.path(w.i)
+	if !IsURL(path) {
+		var err error
+		if path, err = filepath.Abs(path); err != nil {
+			log.Print(err)
+			return
+		}
+	}
+	if err := copyToClipboard(path); err != nil {
+		log.Printf("Could not copy to the clipboard: %v", err)
+		return
+	}
+	if w.opts.Verbose {
+		log.Printf("Copied '%s' to the clipboard.", path)
+	}
+}
+
+// save writes the current image, with its transformations, back to its
+// file.
+func (w *window) save() {
+	path := w.store.path(w.i)
+	if w.store.isVirtual(w.i) || IsURL(path) {
+		log.Printf("Can't save '%s': it isn't a file.", path)
+		return
+	}
+	if isArchived(path) {
+		log.Printf("Can't save '%s' into its archive.", path)
+		return
+	}
+	if isPage(path) {
+		log.Printf("Can't save a single page of a TIFF file: '%s'.", path)
+		return
+	}
+	img, err := w.store.get(w.i)
+	if err != nil {
+		log.Printf("Could not save '%s': %v", path, err)
+		return
+	}
+	if err := saveImage(path, img, w.opts.Quality); err != nil {
+		log.Printf("Could not save '%s': %v", path, err)
+		return
+	}
+	w.store.saved(w.i)
+	// the size of the file, in the status bar, changed.
+	w.frameOK = false
+	if w.opts.Verbose {
+		log.Printf("Saved '%s'.", path)
+	}
+}
+
+// toggleFullscreen switches the window to or from fullscreen mode, if the
+// driver supports it. The window size is restored when leaving fullscreen.
+func (w *window) toggleFullscreen() {
+	fs, ok := w.w.(fullscreener)
+	if !ok {
+		log.Print("Fullscreen mode isn't supported by the shiny driver.")
+		return
+	}
+	w.full = !w.full
+	if w.full {
+		w.prevSize = w.sz.Size()
+	}
+	fs.SetFullscreen(w.full)
+	if r, ok := w.w.(resizer); ok && !w.full {
+		r.Resize(w.prevSize)
+	}
+	w.orig = image.Point{}
+}
+
+// enforceMinSize resizes the window back to its minimum size, if it was
+// made smaller and the driver allows it. It reports whether the window was
+// resized.
+func (w *window) enforceMinSize() bool {
+	r, ok := w.w.(resizer)
+	if !ok || w.full {
+		return false
+	}
+	sz := w.sz.Size()
+	want := image.Point{max(sz.X, w.opts.MinWidth), max(sz.Y, w.opts.MinHeight)}
+	if want == sz {
+		return false
+	}
+	r.Resize(want)
+	return true
+}
+
+// lockAspect resizes the window to the aspect ratio of the image, by
+// shrinking the dimension which is too large, if the driver allows it.
+func (w *window) lockAspect() {
+	r, ok := w.w.(resizer)
+	if !ok || w.full {
+		return
+	}
+	b := w.img().Bounds()
+	sz := w.sz.Size()
+	if b.Empty() || sz.X <= 0 || sz.Y <= 0 {
+		return
+	}
+
+	want := sz
+	if sz.X*b.Dy() > sz.Y*b.Dx() {
+		want.X = max(1, sz.Y*b.Dx()/b.Dy())
+	} else {
+		want.Y = max(1, sz.X*b.Dy()/b.Dx())
+	}
+	want = image.Point{max(want.X, w.opts.MinWidth), max(want.Y, w.opts.MinHeight)}
+	// a pixel of difference is due to rounding, and resizing the window
+	// again for it could go on forever.
+	if d := want.Sub(sz); d.X < -1 || d.X > 1 || d.Y < -1 || d.Y > 1 {
+		r.Resize(want)
+	}
+}
+
+// setCursor changes the shape of the mouse cursor, if the driver allows it.
+func (w *window) setCursor(name string) {
+	if c, ok := w.w.(cursorer); ok {
+		c.SetCursor(name)
+	}
+}
+
+// panBy moves the image by d pixels. Panning is disabled in fit mode.
+func (w *window) panBy(d image.Point) {
+	if w.fit {
+		return
+	}
+	w.orig = w.orig.Add(d)
+	if !w.opts.UnboundedPan {
+		w.clampPan()
+	}
+}
+
+// panAccelTime is how long a panning key must be held down for the
+// increment to grow by the base increment.
+const panAccelTime = 250 * time.Millisecond
+
+// panStep returns the number of pixels a panning key moves the image by. It
+// grows while the key is held down, up to Options.PanAcceleration times the
+// base increment, so that large images are traversed quickly while single
+// presses keep a fine control. With Control held down, the image moves by a
+// single pixel, for precise alignment.
+func (w *window) panStep() int {
+	if w.fine {
+		return 1
+	}
+	held := time.Since(w.pressed).Seconds() / panAccelTime.Seconds()
+	k := math.Min(w.opts.PanAcceleration, 1+held)
+	return int(math.Round(float64(w.opts.StepIncrement) * k))
+}
+
+// panMargin is the width, in pixels, of the sliver of the image which is kept
+// visible when it is panned towards the edges of the window.
+const panMargin = 50
+
+// clampPan adjusts the panning offset so that the image isn't panned out of
+// the window.
+func (w *window) clampPan() {
+	full := w.dst(w.img())
+	mx := min(panMargin, full.Dx())
+	my := min(panMargin, full.Dy())
+	switch {
+	case full.Max.X < mx:
+		w.orig.X += mx - full.Max.X
+	case full.Min.X > w.sz.WidthPx-mx:
+		w.orig.X -= full.Min.X - (w.sz.WidthPx - mx)
+	}
+	switch {
+	case full.Max.Y < my:
+		w.orig.Y += my - full.Max.Y
+	case full.Min.Y > w.sz.HeightPx-my:
+		w.orig.Y -= full.Min.Y - (w.sz.HeightPx - my)
+	}
+}
+
+// goTo makes the i-th image the current one, and starts decoding its
+// neighbors in the background.
+func (w *window) goTo(i int) {
+	w.saveView()
+	w.enter(i)
+}
+
+// drop adds the files dropped onto the window to the displayed images, and
+// goes to the first one of them. They are found with Options.FindFiles, if
+// set, or else directories are skipped.
+func (w *window) drop(paths []string) {
+	if w.opts.Once {
+		return
+	}
+	if w.opts.FindFiles != nil {
+		if files := w.opts.FindFiles(paths); len(files) > 0 {
+			w.goTo(w.store.add(files...))
+			w.w.Send(paint.Event{})
+		}
+		return
+	}
+
+	var files []string
+	for _, p := range paths {
+		fi, err := os.Stat(p)
+		switch {
+		case err != nil:
+			log.Print(err)
+		case fi.IsDir():
+			log.Printf("Skipping the dropped directory '%s'.", p)
+		default:
+			files = append(files, p)
+		}
+	}
+	if len(files) == 0 {
+		return
+	}
+	w.goTo(w.store.add(files...))
+	w.w.Send(paint.Event{})
+}
+
+// viewState is how an image is displayed: its panning offset and zoom.
+type viewState struct {
+	orig image.Point
+	zoom float64
+	fit  bool
+}
+
+// view returns the view state of the current image.
+func (w *window) view() viewState {
+	return viewState{orig: w.orig, zoom: w.zoom, fit: w.fit}
+}
+
+// saveView records the view state of the current image, unless the view is
+// reset for each image.
+func (w *window) saveView() {
+	if w.opts.ResetView {
+		return
+	}
+	w.views[w.i] = w.view()
+}
+
+// forgetView drops the view state of the i-th image, which was removed, and
+// shifts the ones of the following images.
+func (w *window) forgetView(i int) {
+	views := make(map[int]viewState, len(w.views))
+	for j, v := range w.views {
+		switch {
+		case j < i:
+			views[j] = v
+		case j > i:
+			views[j-1] = v
+		}
+	}
+	w.views = views
+}
+
+// enter displays the i-th image, restoring its view state if it was already
+// displayed before.
+func (w *window) enter(i int) {
+	w.stopGlide()
+	w.i = i
+	w.orig, w.zoom, w.fit = image.Point{}, w.opts.Zoom, false
+	if v, ok := w.views[i]; ok {
+		w.orig, w.zoom, w.fit = v.orig, v.zoom, v.fit
+	}
+	if !w.opts.KeepFilter {
+		w.filter = filterNone
+	}
+	w.filterCache = filterCache{}
+	w.ditherCache = ditherCache{}
+	// the EXIF orientation is only undone for the image it was toggled on.
+	w.unoriented, w.orientCache = false, orientCache{}
+	w.stretchCache = stretchCache{}
+	if w.cropping {
+		w.toggleCrop()
+	}
+	w.retitle()
+	w.prefetch()
+}
+
+// prefetch decodes the images around the current one in the background.
+func (w *window) prefetch() {
+	n := w.store.len()
+	if n < 2 {
+		return
+	}
+	w.store.prefetch((w.i+1)%n, (w.i+n-1)%n)
+}
+
+// newBuffer makes sure the buffer is large enough for the current window
+// size. The buffer is only reallocated when it grows, so that resizing the
+// window continuously doesn't allocate a new buffer for every size event.
+// If it can't be, the last buffer is kept and w.bufErr is set.
+func (w *window) newBuffer() {
+	sz := w.sz.Size()
+	if w.b != nil && sz.X <= w.bufSize.X && sz.Y <= w.bufSize.Y {
+		w.bufErr = nil
+		return
+	}
+	sz = image.Point{max(sz.X, w.bufSize.X), max(sz.Y, w.bufSize.Y)}
+	b, err := w.s.NewBuffer(sz)
+	if err != nil {
+		// the last buffer, if any, is kept to tell the user.
+		log.Printf("Could not allocate a buffer of %dx%d: %v", sz.X, sz.Y, err)
+		w.bufErr = err
+		return
+	}
+	if w.b != nil {
+		w.b.Release()
+	}
+	w.b, w.bufSize, w.bufErr = b, sz, nil
+	w.frameOK = false
+}
+
+// displayBufErr shows, in what the last buffer covers of the window, the
+// error which prevented allocating a buffer matching the window.
+func (w *window) displayBufErr() {
+	w.frameOK = false
+	dst := w.canvas()
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(w.opts.Background), image.Point{}, draw.Src)
+	r := dst.Bounds()
+	r.Max.Y = min(r.Max.Y, r.Min.Y+w.textHeight())
+	w.drawTextBox(dst, r, fmt.Sprintf("could not allocate a buffer (%v): "+
+		"resize the window to retry, or quit", w.bufErr))
+	w.w.Upload(image.Point{}, w.b, dst.Bounds())
+	w.w.Publish()
+}
+
+// canvas returns the part of the buffer matching the window.
+func (w *window) canvas() *image.RGBA {
+	return w.b.RGBA().SubImage(w.sz.Bounds()).(*image.RGBA)
+}
+
+// scale returns the scale factor applied to img when it is displayed.
+// In fit mode, images larger than the window are shrunk so that they fit
+// entirely inside it, preserving their aspect ratio.
+func (w *window) scale(img image.Image) float64 {
+	if !w.fit {
+		return w.zoom
+	}
+	b := img.Bounds()
+	sx := float64(w.sz.WidthPx) / float64(b.Dx())
+	sy := float64(w.sz.HeightPx) / float64(b.Dy())
+	return math.Min(1, math.Min(sx, sy))
+}
+
+// unfit leaves the fit mode, keeping the current scale as the zoom factor.
+func (w *window) unfit() {
+	if !w.fit {
+		return
+	}
+	w.zoom = w.scale(w.img())
+	w.fit = false
+}
+
+// scaledSize returns the size of img once the scale factor is applied.
+func (w *window) scaledSize(img image.Image) image.Point {
+	b := img.Bounds()
+	z := w.scale(img)
+	return image.Point{
+		max(1, int(math.Round(float64(b.Dx())*z))),
+		max(1, int(math.Round(float64(b.Dy())*z))),
+	}
+}
+
+// dst returns the rectangle, in window coordinates, covered by img once
+// scaled and panned.
+func (w *window) dst(img image.Image) image.Rectangle {
+	r := image.Rectangle{Max: w.scaledSize(img)}
+	dp := vpCenter(r, w.sz.WidthPx, w.sz.HeightPx)
+	return r.Add(dp).Add(w.orig)
+}
+
+// visible returns sr, the part of img visible in the window once panned
+// and scaled, and dr, the rectangle of the window it is drawn to.
+// sr is offset by the pan origin and clamped to the image bounds, so that
+// only the visible pixels have to be scaled. It is empty when the image is
+// entirely out of view.
+func (w *window) visible(img image.Image) (sr, dr image.Rectangle) {
+	b := img.Bounds()
+	full := w.dst(img)
+	vis := full.Intersect(w.sz.Bounds())
+	if vis.Empty() {
+		return image.Rectangle{}, image.Rectangle{}
+	}
+
+	zx := float64(full.Dx()) / float64(b.Dx())
+	zy := float64(full.Dy()) / float64(b.Dy())
+	vis = vis.Sub(full.Min)
+	sr = image.Rectangle{
+		Min: image.Point{
+			int(math.Floor(float64(vis.Min.X) / zx)),
+			int(math.Floor(float64(vis.Min.Y) / zy)),
+		},
+		Max: image.Point{
+			int(math.Ceil(float64(vis.Max.X) / zx)),
+			int(math.Ceil(float64(vis.Max.Y) / zy)),
+		},
+	}.Add(b.Min).Intersect(b)
+
+	// the source pixels on the edges may be partially visible only.
+	r := sr.Sub(b.Min)
+	dr = image.Rectangle{
+		Min: image.Point{
+			int(math.Round(float64(r.Min.X) * zx)),
+			int(math.Round(float64(r.Min.Y) * zy)),
+		},
+		Max: image.Point{
+			int(math.Round(float64(r.Max.X) * zx)),
+			int(math.Round(float64(r.Max.Y) * zy)),
+		},
+	}.Add(full.Min)
+	return sr, dr
+}
+
+// setZoom sets the zoom factor to z, clamped to [minZoom, maxZoom].
+// The origin is adjusted so that the point of the image under the center
+// of the window stays in place.
+func (w *window) setZoom(z float64) {
+	w.setZoomAt(z, image.Point{w.sz.WidthPx / 2, w.sz.HeightPx / 2})
+}
+
+// setZoomAt sets the zoom factor to z, clamped to [minZoom, maxZoom].
+// The origin is adjusted so that the point of the image under c, in window
+// coordinates, stays in place.
+func (w *window) setZoomAt(z float64, c image.Point) {
+	z = math.Max(minZoom, math.Min(maxZoom, z))
+	if z == w.zoom {
+		return
+	}
+
+	img := w.img()
+	dr := w.dst(img)
+
+	// position of c, in unscaled image pixels.
+	px := float64(c.X-dr.Min.X) / w.zoom
+	py := float64(c.Y-dr.Min.Y) / w.zoom
+
+	w.zoom = z
+	r := image.Rectangle{Max: w.scaledSize(img)}
+	tl := image.Point{
+		c.X - int(math.Round(px*z)),
+		c.Y - int(math.Round(py*z)),
+	}
+	w.orig = tl.Sub(vpCenter(r, w.sz.WidthPx, w.sz.HeightPx))
+}
+
+// display draws the current image into the window.
+func (w *window) display() {
+	if w.b == nil {
+		return
+	}
+	if w.bufErr != nil {
+		if w.newBuffer(); w.bufErr != nil {
+			w.displayBufErr()
+			return
+		}
+	}
+	if w.grid {
+		w.displayGrid()
+		return
+	}
+
+	// the whole window is composited into the buffer before being
+	// uploaded at once, so that no intermediate state is ever shown.
+	img, ok := w.tryImg()
+	dst := w.canvas()
+	if !ok {
+		w.displaySpinner(dst)
+		return
+	}
+	sr, dr := w.visible(img)
+
+	// 16-bit images are dithered down to the 8 bits of the buffer.
+	src := w.dithered(img)
+	if w.canUseTexture(img) && w.displayTexture(src, sr, dr) {
+		return
+	}
+
+	// the buffer is only composited again when the frame changed, e.g.
+	// not for the repaints triggered by moving the mouse.
+	f := w.frameOf(img, sr, dr)
+	if w.frameOK && f == w.frame {
+		w.w.Upload(image.Point{}, w.b, dst.Bounds())
+		w.w.Publish()
+		return
+	}
+	w.frame, w.frameOK = f, true
+
+	op := draw.Src
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(w.background(img)), image.Point{}, draw.Src)
+	if w.opts.Checker {
+		// the checkerboard only covers the image, and shows through its
+		// transparent parts: the rest of the window keeps the background.
+		drawChecker(dst, w.dst(img).Intersect(dst.Bounds()))
+		op = draw.Over
+	}
+	if v, ok := img.(*vectorImage); ok && w.scale(img) > 1 {
+		// vector images are rasterized again at the current scale, rather
+		// than blowing up their pixels.
+		full := w.dst(img)
+		if vis := full.Intersect(dst.Bounds()); !vis.Empty() {
+			v.drawScaled(dst, full, vis, op)
+		}
+	} else if !sr.Empty() {
+		if w.scale(img) == 1 {
+			draw.Draw(dst, dr, src, sr.Min, op)
+		} else {
+			w.scaler(img).Scale(dst, dr, src, sr, op, nil)
+			if w.interpDiff {
+				w.drawInterpDiff(dst, dr, img, src, sr)
+			}
+		}
+	}
+	if w.info {
+		w.drawTextBox(dst, w.statusRect(), w.status(img))
+	}
+	// the overlays of the top left corner are stacked, from the top down.
+	top := 0
+	if err := w.store.decodeErr(w.i); err != nil {
+		r := w.sz.Bounds()
+		r.Max.Y = min(r.Max.Y, r.Min.Y+w.textHeight())
+		w.drawTextBox(dst, r, err.Error())
+		top += w.textHeight()
+	}
+	if w.store.orientation(w.i) != 1 {
+		w.drawOrientation(dst, top)
+		top += w.textHeight()
+	}
+	if w.histogram {
+		w.drawHistogram(dst, img, top)
+	}
+	if w.inspect {
+		w.drawInspector(dst, img)
+	}
+	if w.cropping {
+		w.drawSelection(dst, img)
+	}
+
+	w.w.Upload(image.Point{}, w.b, dst.Bounds())
+	w.w.Publish()
+}
+
+// statusRect returns the rectangle covered by the status bar, at the
+// bottom of the window.
+func (w *window) statusRect() image.Rectangle {
+	r := w.sz.Bounds()
+	r.Min.Y = max(r.Min.Y, r.Max.Y-w.textHeight())
+	return r
+}
+
+// status returns the text of the status bar describing img, the current
+// image.
+func (w *window) status(img image.Image) string {
+	b := img.Bounds()
+	s := fmt.Sprintf("%s  %dx%d  %.0f%%", w.store.name(w.i), b.Dx(), b.Dy(),
+		100*w.scale(img))
+	if fi, err := os.Stat(w.store.path(w.i)); err == nil && !w.store.isVirtual(w.i) {
+		s += "  " + byteSize(fi.Size())
+	}
+	if info := w.store.info(w.i); info.decodeTime > 0 {
+		s += "  decoded in " + info.decodeTime.Round(time.Millisecond).String()
+	}
+	if w.filter != filterNone {
+		s += "  " + w.filter.String()
+	}
+	if w.interp != interpDefault {
+		s += "  " + w.interp.String()
+	}
+	if w.interpDiff {
+		s += "  interpolation differences"
+	}
+	switch o := w.store.orientation(w.i); {
+	case o != 1 && w.unoriented:
+		s += fmt.Sprintf("  EXIF orientation %d off", o)
+	case o != 1:
+		s += fmt.Sprintf("  EXIF orientation %d", o)
+	}
+	if a := w.pixelAspect(); a != 1 {
+		s += fmt.Sprintf("  pixel aspect %.3g", a)
+	}
+	if w.store.isMarked(w.i) {
+		s += "  [marked]"
+	}
+	return s
+}
+
+// checkerSize is the size, in pixels, of the squares of the checkerboard.
+const checkerSize = 8
+
+// checkerTile is a tile of the checkerboard pattern, generated on first use.
+var (
+	checkerTile *image.RGBA
+	checkerOnce sync.Once
+)
+
+// frame describes what is composited into the buffer, so that it isn't
+// composited again when nothing changed.
+type frame struct {
+	i         int
+	img       image.Image
+	sr, dr    image.Rectangle
+	size      image.Point
+	info      bool
+	marked    bool // only relevant with the status bar
+	histogram bool
+	inspect   bool
+	cursor    image.Point // only relevant when inspecting pixels
+	interp    interp
+	diff      bool
+	cropping  bool
+	sel       image.Rectangle
+}
+
+// frameOf returns the frame displaying the part sr of img into the part dr
+// of the window.
+func (w *window) frameOf(img image.Image, sr, dr image.Rectangle) frame {
+	f := frame{
+		i:         w.i,
+		img:       img,
+		sr:        sr,
+		dr:        dr,
+		size:      w.sz.Size(),
+		info:      w.info,
+		histogram: w.histogram,
+		inspect:   w.inspect,
+		interp:    w.interp,
+		diff:      w.interpDiff,
+		cropping:  w.cropping,
+		sel:       w.sel,
+	}
+	if w.inspect {
+		f.cursor = w.cursor
+	}
+	if w.info {
+		f.marked = w.store.isMarked(w.i)
+	}
+	return f
+}
+
+// displaySpinner shows the loading spinner in dst, while the current image is
+// being decoded, and schedules its next frame.
+func (w *window) displaySpinner(dst draw.Image) {
+	w.frameOK = false
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(w.opts.Background), image.Point{}, draw.Src)
+	drawSpinner(dst, int(time.Since(w.loadStart)/spinFrame))
+	if w.info {
+		w.drawTextBox(dst, w.statusRect(), w.store.name(w.i))
+	}
+	w.w.Upload(image.Point{}, w.b, dst.Bounds())
+	w.w.Publish()
+
+	if !w.spinning && !w.unfocused {
+		w.spinning = true
+		time.AfterFunc(spinFrame, func() { w.w.Send(spinEvent{}) })
+	}
+}
+
+// background returns the color filling the window around img: either the
+// configured background color, or the average of the colors of the corners
+// of img.
+func (w *window) background(img image.Image) color.Color {
+	if !w.opts.BackgroundFromImage {
+		return w.opts.Background
+	}
+	b := img.Bounds()
+	if b.Empty() {
+		return w.opts.Background
+	}
+	var r, g, bl, a uint32
+	for _, p := range []image.Point{
+		b.Min,
+		{b.Max.X - 1, b.Min.Y},
+		{b.Min.X, b.Max.Y - 1},
+		b.Max.Sub(image.Point{1, 1}),
+	} {
+		cr, cg, cb, ca := img.At(p.X, p.Y).RGBA()
+		r, g, bl, a = r+cr, g+cg, bl+cb, a+ca
+	}
+	// the window has no transparency, so the corners are composited over
+	// the configured background.
+	col := color.RGBA64{uint16(r / 4), uint16(g / 4), uint16(bl / 4), uint16(a / 4)}
+	dst := image.NewRGBA64(image.Rect(0, 0, 1, 1))
+	dst.Set(0, 0, w.opts.Background)
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(col), image.Point{}, draw.Over)
+	return dst.At(0, 0)
+}
+
+// drawChecker fills r with a gray checkerboard pattern.
+func drawChecker(dst draw.Image, r image.Rectangle) {
+	checkerOnce.Do(func() {
+		const n = 32 * checkerSize
+		checkerTile = image.NewRGBA(image.Rect(0, 0, n, n))
+		light := color.RGBA{0xcc, 0xcc, 0xcc, 0xff}
+		dark := color.RGBA{0x99, 0x99, 0x99, 0xff}
+		for y := 0; y < n; y++ {
+			for x := 0; x < n; x++ {
+				c := light
+				if (x/checkerSize+y/checkerSize)%2 == 1 {
+					c = dark
+				}
+				checkerTile.SetRGBA(x, y, c)
+			}
+		}
+	})
+
+	tile := checkerTile.Bounds().Size()
+	for y := r.Min.Y; y < r.Max.Y; y += tile.Y {
+		for x := r.Min.X; x < r.Max.X; x += tile.X {
+			tr := image.Rectangle{image.Point{x, y}, image.Point{x, y}.Add(tile)}
+			draw.Draw(dst, tr.Intersect(r), checkerTile, image.Point{}, draw.Src)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package viewer
+
+import (
+	"image"
+	"testing"
+	"time"
+
+	"golang.org/x/mobile/event/key"
+)
+
+func TestPanAcceleration(t *testing.T) {
+	w := benchWindow(t, image.Point{64, 64}, 1)
+	base := w.opts.StepIncrement
+	top := int(float64(base) * w.opts.PanAcceleration)
+	press := key.Event{Code: key.CodeH, Direction: key.DirPress}
+	release := key.Event{Code: key.CodeH, Direction: key.DirRelease}
+
+	w.key(press)
+	if got := w.panStep(); got != base {
+		t.Fatalf("panStep() = %d on the first press, want %d", got, base)
+	}
+
+	// the key is held down for a while, and autorepeated as more presses.
+	held := time.Now().Add(-panAccelTime / 2)
+	w.pressed = held
+	prev := w.panStep()
+	for i := 0; i < 40; i++ {
+		w.key(press)
+		if !w.pressed.Equal(held) {
+			t.Fatalf("autorepeat %d restarted the acceleration", i)
+		}
+		held = held.Add(-panAccelTime / 2)
+		w.pressed = held
+		got := w.panStep()
+		if got < prev || got > top {
+			t.Fatalf("panStep() = %d after autorepeat %d, want in [%d, %d]", got, i, prev, top)
+		}
+		prev = got
+	}
+	if prev != top {
+		t.Errorf("panStep() = %d while held, want %d", prev, top)
+	}
+
+	// another key, pressed while the first one is held, starts over.
+	w.key(key.Event{Code: key.CodeL, Direction: key.DirPress})
+	if got := w.panStep(); got != base {
+		t.Errorf("panStep() = %d after pressing another key, want %d", got, base)
+	}
+	w.key(key.Event{Code: key.CodeL, Direction: key.DirRelease})
+
+	// so does pressing the key again once released.
+	w.key(press)
+	w.pressed = time.Now().Add(-10 * panAccelTime)
+	w.key(release)
+	w.key(press)
+	if got := w.panStep(); got != base {
+		t.Errorf("panStep() = %d after releasing the key, want %d", got, base)
+	}
+}
+
+func TestResetView(t *testing.T) {
+	w := benchWindow(t, image.Point{1600, 1200}, 1)
+	w.toggleFit()
+	w.zoom, w.orig = 2, image.Point{10, 20}
+	w.resetView()
+	if w.fit || w.zoom != w.opts.Zoom || w.orig != (image.Point{}) {
+		t.Errorf("reset view: fit=%v, zoom=%g, orig=%v, want false, %g, %v",
+			w.fit, w.zoom, w.orig, w.opts.Zoom, image.Point{})
+	}
+}